@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	calendarWeeks         = 4
+	calendarReminderLen   = 30 * time.Minute
+	calendarTimeLayout    = "20060102T150405Z"
+	calendarLineLimit     = 75
+	calendarShutdownDelay = 5 * time.Second
+	calendarHeaderTimeout = 5 * time.Second
+	calendarReadTimeout   = 10 * time.Second
+	calendarWriteTimeout  = 30 * time.Second
+	calendarIdleTimeout   = 60 * time.Second
+)
+
+type calendarEvent struct {
+	UID         string
+	Start       time.Time
+	End         time.Time
+	Summary     string
+	Description string
+}
+
+// calendarEvents lists class occurrences and registration openings for the
+// next calendarWeeks weeks. When realName is set, events include that
+// student's place in the queue.
+func (ns *NotificationService) calendarEvents(realName string) []calendarEvent {
+	now := getLocalTime()
+	events := make([]calendarEvent, 0)
+
+	for _, subject := range ns.queueManager.GetSubjects() {
+		startTime := GetNextSubjectTime(subject)
+		endTime := GetNextSubjectEndTime(subject)
+		if startTime == nil || endTime == nil {
+			continue
+		}
+		code, _ := ns.queueManager.GetColumnMapping(subject.Name)
+
+		for _, start := range upcomingSubjectTimes(subject, *startTime, now.AddDate(0, 0, 7*calendarWeeks)) {
+			end := start.Add(endTime.Sub(*startTime))
+			sessionID := newSessionID(code, start)
+
+			description := ns.plain("calendar.class_description", vars{"OpensAt": ns.registrationOpenTime(start).Format("02.01 15:04")})
+			summary := subject.Name
+			if session, exists := ns.queueManager.GetSession(sessionID); exists && realName != "" {
+				if i := session.position(realName); i >= 0 {
+					position := vars{"Subject": subject.Name, "Position": i + 1, "Total": len(session.Queue)}
+					summary = ns.plain("calendar.class_in_queue", position)
+					description = ns.plain("calendar.class_in_queue_description", position)
+				} else if i := session.waitlistPosition(realName); i >= 0 {
+					position := vars{"Subject": subject.Name, "Position": i + 1}
+					summary = ns.plain("calendar.class_in_waitlist", position)
+					description = ns.plain("calendar.class_in_waitlist_description", position)
+				}
+			}
+
+			events = append(events, calendarEvent{
+				UID:         sessionID,
+				Start:       start,
+				End:         end,
+				Summary:     summary,
+				Description: description,
+			})
+
+			opensAt := ns.registrationOpenTime(start)
+			if opensAt.After(now) {
+				events = append(events, calendarEvent{
+					UID:         "registration-" + sessionID,
+					Start:       opensAt,
+					End:         opensAt.Add(calendarReminderLen),
+					Summary:     ns.plain("calendar.registration", vars{"Subject": subject.Name}),
+					Description: ns.plain("calendar.registration_description", vars{"Start": start.Format("02.01 15:04")}),
+				})
+			}
+		}
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Start.Before(events[j].Start)
+	})
+	return events
+}
+
+func escapeICSText(s string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+	return replacer.Replace(s)
+}
+
+// foldICSLine splits content lines longer than 75 octets as required by
+// RFC 5545, without breaking UTF-8 sequences.
+func foldICSLine(line string) string {
+	var b strings.Builder
+	width := 0
+	for _, r := range line {
+		size := len(string(r))
+		if width+size > calendarLineLimit {
+			b.WriteString("\r\n ")
+			width = 1
+		}
+		b.WriteRune(r)
+		width += size
+	}
+	b.WriteString("\r\n")
+	return b.String()
+}
+
+func renderICS(name string, events []calendarEvent) string {
+	stamp := time.Now().UTC().Format(calendarTimeLayout)
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//queue-bot//schedule//RU",
+		"CALSCALE:GREGORIAN",
+		"METHOD:PUBLISH",
+		"X-WR-CALNAME:" + escapeICSText(name),
+	}
+	for _, event := range events {
+		lines = append(lines,
+			"BEGIN:VEVENT",
+			"UID:"+event.UID+"@queue-bot",
+			"DTSTAMP:"+stamp,
+			"DTSTART:"+event.Start.UTC().Format(calendarTimeLayout),
+			"DTEND:"+event.End.UTC().Format(calendarTimeLayout),
+			"SUMMARY:"+escapeICSText(event.Summary),
+			"DESCRIPTION:"+escapeICSText(event.Description),
+			"END:VEVENT",
+		)
+	}
+	lines = append(lines, "END:VCALENDAR")
+
+	var b strings.Builder
+	for _, line := range lines {
+		b.WriteString(foldICSLine(line))
+	}
+	return b.String()
+}
+
+func (ns *NotificationService) handleCalendarRequest(w http.ResponseWriter, r *http.Request) {
+	realName := ""
+	if token := r.URL.Query().Get("token"); token != "" {
+		owner, exists := ns.stateStore.CalendarOwner(token)
+		if !exists {
+			http.Error(w, "unknown token", http.StatusNotFound)
+			return
+		}
+		realName = owner
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="queue.ics"`)
+	if _, err := w.Write([]byte(renderICS(ns.plain("calendar.name", nil), ns.calendarEvents(realName)))); err != nil {
+		log.Printf("Error writing calendar response: %v", err)
+	}
+}
+
+// StartCalendarServer serves the schedule feed at /calendar.ics; personal
+// feeds with queue positions take the token handed out by /calendar.
+func (ns *NotificationService) StartCalendarServer(ctx context.Context) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/calendar.ics", ns.handleCalendarRequest)
+
+	server := &http.Server{
+		Addr:              ns.config.CalendarAddr,
+		Handler:           mux,
+		ReadHeaderTimeout: calendarHeaderTimeout,
+		ReadTimeout:       calendarReadTimeout,
+		WriteTimeout:      calendarWriteTimeout,
+		IdleTimeout:       calendarIdleTimeout,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), calendarShutdownDelay)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("📅 Calendar feed listening on %s", ns.config.CalendarAddr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("Error running calendar server: %v", err)
+	}
+}
+
+func (ns *NotificationService) handleCalendarCommand(message *tgbotapi.Message) {
+	user := message.From
+	realName := ns.queueManager.GetUserRealName(user.UserName, user.FirstName, user.LastName)
+
+	doc := tgbotapi.NewDocument(message.Chat.ID, tgbotapi.FileBytes{
+		Name:  "queue.ics",
+		Bytes: []byte(renderICS(ns.plain("calendar.name", nil), ns.calendarEvents(realName))),
+	})
+	feed := ""
+	if realName != "" && ns.config.CalendarURL != "" && message.Chat.IsPrivate() {
+		token, err := ns.stateStore.CalendarToken(realName)
+		if err != nil {
+			log.Printf("Error issuing calendar token for %s: %v", realName, err)
+		} else {
+			feed = strings.TrimSuffix(ns.config.CalendarURL, "/") + "/calendar.ics?token=" + token
+		}
+	}
+
+	doc.Caption = ns.t("calendar.caption", vars{"Personal": realName != "", "Feed": feed})
+	doc.ParseMode = parseModeHTML
+	if _, err := ns.bot.Send(doc); err != nil {
+		log.Printf("Error sending calendar: %v", err)
+	}
+}
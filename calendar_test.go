@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPersonalCalendarNeedsToken(t *testing.T) {
+	ns, _, _ := newTestService(t, 1, QueueMessageSeparate)
+	session := openSession(t, ns)
+	pressButton(ns, 0, "join_"+session.ID)
+
+	fetch := func(query string) (int, string) {
+		recorder := httptest.NewRecorder()
+		ns.handleCalendarRequest(recorder, httptest.NewRequest(http.MethodGet, "/calendar.ics"+query, nil))
+		return recorder.Code, strings.ReplaceAll(recorder.Body.String(), "\r\n ", "")
+	}
+	personal := ns.plain("calendar.class_in_queue", vars{"Subject": testSubject, "Position": 1, "Total": 1})
+
+	if code, body := fetch("?user=" + studentUsername(0)); code != http.StatusOK || strings.Contains(body, escapeICSText(personal)) {
+		t.Errorf("username query: status %d, personal feed served %v", code, strings.Contains(body, escapeICSText(personal)))
+	}
+	if code, _ := fetch("?token=guess"); code != http.StatusNotFound {
+		t.Errorf("unknown token: status %d, want 404", code)
+	}
+
+	token, err := ns.stateStore.CalendarToken(studentName(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := ns.stateStore.CalendarToken(studentName(0)); again != token {
+		t.Errorf("token changed from %s to %s", token, again)
+	}
+	if code, body := fetch("?token=" + token); code != http.StatusOK || !strings.Contains(body, escapeICSText(personal)) {
+		t.Errorf("token: status %d, personal feed missing:\n%s", code, body)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"log"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func (ns *NotificationService) HandleMessage(message *tgbotapi.Message) {
+	if !message.IsCommand() {
+		return
+	}
+
+	switch message.Command() {
+	case "start":
+		ns.handleStartCommand(message)
+	case "remind":
+		ns.handleRemindCommand(message)
+	case "stop":
+		ns.handleStopCommand(message)
+	case "swap":
+		ns.handleSwapCommand(message)
+	case "join":
+		ns.handleJoinCommand(message)
+	case "note":
+		ns.handleNoteCommand(message)
+	case "done":
+		ns.handleLabStatusCommand(message, true)
+	case "undone":
+		ns.handleLabStatusCommand(message, false)
+	case "progress":
+		ns.handleProgressCommand(message)
+	case "stats":
+		ns.handleStatsCommand(message)
+	case "export":
+		ns.handleExportCommand(message)
+	case "calendar":
+		ns.handleCalendarCommand(message)
+	case "cancel":
+		ns.handleCancelCommand(message)
+	case "reschedule":
+		ns.handleRescheduleCommand(message)
+	}
+}
+
+func (ns *NotificationService) reply(message *tgbotapi.Message, text string) {
+	msg := ns.newMessage(message.Chat.ID, text)
+	msg.ReplyToMessageID = message.MessageID
+	if _, err := ns.bot.Send(msg); err != nil {
+		log.Printf("Error sending command reply: %v", err)
+	}
+}
+
+func (ns *NotificationService) handleStartCommand(message *tgbotapi.Message) {
+	if !message.Chat.IsPrivate() {
+		ns.reply(message, ns.t("start.private_only", nil))
+		return
+	}
+
+	user := message.From
+	realName := ns.queueManager.GetUserRealName(user.UserName, user.FirstName, user.LastName)
+	if realName == "" {
+		ns.reply(message, ns.t("start.unknown_user", nil))
+		return
+	}
+	ns.queueManager.RememberUserID(realName, user.ID)
+
+	err := ns.subscriptionStore.Subscribe(Subscription{
+		UserID:   user.ID,
+		ChatID:   message.Chat.ID,
+		Username: user.UserName,
+		RealName: realName,
+	})
+	if err != nil {
+		log.Printf("Error subscribing %s: %v", realName, err)
+		ns.reply(message, ns.t("start.save_error", nil))
+		return
+	}
+
+	subscription, _ := ns.subscriptionStore.Get(user.ID)
+	ns.reply(message, ns.t("start.subscribed", vars{"Name": realName, "WarnAhead": subscription.WarnAhead}))
+
+	log.Printf("User %s subscribed to reminders", realName)
+}
+
+func (ns *NotificationService) handleRemindCommand(message *tgbotapi.Message) {
+	if !message.Chat.IsPrivate() {
+		return
+	}
+
+	if _, subscribed := ns.subscriptionStore.Get(message.From.ID); !subscribed {
+		ns.reply(message, ns.t("remind.not_subscribed", nil))
+		return
+	}
+
+	warnAhead, err := strconv.Atoi(strings.TrimSpace(message.CommandArguments()))
+	if err != nil || warnAhead < 0 || warnAhead > maxWarnAhead {
+		ns.reply(message, ns.t("remind.usage", vars{"Max": maxWarnAhead}))
+		return
+	}
+
+	if err := ns.subscriptionStore.SetWarnAhead(message.From.ID, warnAhead); err != nil {
+		log.Printf("Error updating reminder settings for %d: %v", message.From.ID, err)
+		ns.reply(message, ns.t("remind.save_error", nil))
+		return
+	}
+
+	ns.reply(message, ns.t("remind.updated", vars{"WarnAhead": warnAhead}))
+}
+
+func (ns *NotificationService) handleStopCommand(message *tgbotapi.Message) {
+	if !message.Chat.IsPrivate() {
+		return
+	}
+
+	if err := ns.subscriptionStore.Unsubscribe(message.From.ID); err != nil {
+		log.Printf("Error unsubscribing %d: %v", message.From.ID, err)
+		ns.reply(message, ns.t("stop.error", nil))
+		return
+	}
+
+	ns.reply(message, ns.t("stop.success", nil))
+}
@@ -1,49 +1,493 @@
 package main
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"log"
 	"os"
+	"regexp"
 	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
+const defaultConfigFile = "config.yaml"
+
+const storageBackendJSON = "json"
+
+var sheetColumnPattern = regexp.MustCompile(`^[A-Z]{1,3}$`)
+
 type Config struct {
 	TelegramBotToken      string
 	QueueChatID           int64
+	GroupName             string
+	Language              string
+	MessagesFile          string
 	GoogleSheetsID        string
 	GoogleCredentialsFile string
 	GoogleCredentialsJSON string
+	SheetsLastColumn      string
+	StorageBackend        string
+	HistoryFile           string
+	SubscriptionsFile     string
+	DebtsFile             string
+	LabsFile              string
+	ProgressFile          string
+	QueueMessagesFile     string
+	UserMappingFile       string
+	OverridesFile         string
+	StateFile             string
+	ArchiveToSheets       bool
+	AdminIDs              []int64
+	RegistrationWindow    time.Duration
+	LotteryWindow         time.Duration
+	NotificationDedupe    time.Duration
+	StaleOperationTimeout time.Duration
+	SwapRequestTTL        time.Duration
+	QueueMessageMode      QueueMessageMode
+	AnnounceJoins         bool
+	PinMessages           bool
+	SendRateGlobal        int
+	SendRateChat          int
+	QueueEditDelay        time.Duration
+	CalendarAddr          string
+	CalendarURL           string
+	SubjectsFile          string
+	Location              *time.Location
+	ScheduleICSFile       string
+	ScheduleMappingFile   string
 }
 
+// GroupConfig describes one student group and its chat. The bot serves a
+// single group per process.
+type GroupConfig struct {
+	Name            string `yaml:"name"`
+	ChatID          int64  `yaml:"chat_id"`
+	TimeZone        string `yaml:"time_zone"`
+	Schedule        string `yaml:"schedule"`
+	ScheduleICS     string `yaml:"schedule_ics"`
+	ScheduleMapping string `yaml:"schedule_mapping"`
+	Language        string `yaml:"language"`
+	Messages        string `yaml:"messages"`
+	QueueMessage    string `yaml:"queue_message"`
+	AnnounceJoins   *bool  `yaml:"announce_joins"`
+	PinMessages     *bool  `yaml:"pin_messages"`
+}
+
+type fileConfig struct {
+	Telegram struct {
+		Token          string  `yaml:"token"`
+		AdminIDs       []int64 `yaml:"admin_ids"`
+		SendRateGlobal int     `yaml:"send_rate_global"`
+		SendRateChat   int     `yaml:"send_rate_chat"`
+	} `yaml:"telegram"`
+	Groups []GroupConfig `yaml:"groups"`
+	Google struct {
+		SheetsID        string `yaml:"sheets_id"`
+		CredentialsFile string `yaml:"credentials_file"`
+		CredentialsJSON string `yaml:"credentials_json"`
+		ArchiveToSheets bool   `yaml:"archive_to_sheets"`
+		LastColumn      string `yaml:"last_column"`
+	} `yaml:"google"`
+	Storage struct {
+		Backend           string `yaml:"backend"`
+		HistoryFile       string `yaml:"history_file"`
+		SubscriptionsFile string `yaml:"subscriptions_file"`
+		DebtsFile         string `yaml:"debts_file"`
+		LabsFile          string `yaml:"labs_file"`
+		ProgressFile      string `yaml:"progress_file"`
+		QueueMessagesFile string `yaml:"queue_messages_file"`
+		UserMappingFile   string `yaml:"user_mapping_file"`
+		OverridesFile     string `yaml:"overrides_file"`
+		StateFile         string `yaml:"state_file"`
+	} `yaml:"storage"`
+	Timing struct {
+		RegistrationWindow time.Duration `yaml:"registration_window"`
+		LotteryWindow      time.Duration `yaml:"lottery_window"`
+		NotificationDedupe time.Duration `yaml:"notification_dedupe"`
+		StaleOperation     time.Duration `yaml:"stale_operation"`
+		SwapRequestTTL     time.Duration `yaml:"swap_request_ttl"`
+		QueueEditDelay     time.Duration `yaml:"queue_edit_delay"`
+	} `yaml:"timing"`
+	Calendar struct {
+		Addr string `yaml:"addr"`
+		URL  string `yaml:"url"`
+	} `yaml:"calendar"`
+}
+
+func defaultConfig() *Config {
+	return &Config{
+		Language:              defaultLanguage,
+		SheetsLastColumn:      "ZZ",
+		StorageBackend:        storageBackendJSON,
+		HistoryFile:           "queue_history.json",
+		SubscriptionsFile:     "subscriptions.json",
+		DebtsFile:             "debts.json",
+		LabsFile:              "labs.json",
+		ProgressFile:          "progress.json",
+		QueueMessagesFile:     "queue_messages.json",
+		UserMappingFile:       "user_mapping.json",
+		OverridesFile:         "schedule_overrides.json",
+		StateFile:             "state.json",
+		RegistrationWindow:    24 * time.Hour,
+		LotteryWindow:         12 * time.Hour,
+		NotificationDedupe:    6 * time.Hour,
+		StaleOperationTimeout: 30 * time.Second,
+		SwapRequestTTL:        10 * time.Minute,
+		QueueMessageMode:      QueueMessageSeparate,
+		AnnounceJoins:         true,
+		PinMessages:           true,
+		SendRateGlobal:        30,
+		SendRateChat:          20,
+		QueueEditDelay:        3 * time.Second,
+		SubjectsFile:          "queue_lessons.txt",
+		ScheduleMappingFile:   "schedule_mapping.json",
+	}
+}
+
+// LoadConfig builds the configuration in layers: built-in defaults, then the
+// YAML file from CONFIG_FILE (config.yaml if present), then environment
+// variables, and validates the result.
 func LoadConfig() (*Config, error) {
-	config := &Config{}
+	config, err := readConfig()
+	if err != nil {
+		return nil, err
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// LoadOfflineConfig is LoadConfig for subcommands that only read local files
+// and therefore do not need Telegram or Google credentials.
+func LoadOfflineConfig() (*Config, error) {
+	config, err := readConfig()
+	if err != nil {
+		return nil, err
+	}
+	if err := config.validateSettings(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
 
-	config.TelegramBotToken = os.Getenv("TELEGRAM_BOT_TOKEN")
-	if config.TelegramBotToken == "" {
-		return nil, fmt.Errorf("TELEGRAM_BOT_TOKEN environment variable is not set")
+func readConfig() (*Config, error) {
+	config := defaultConfig()
+	timeZone := defaultTimeZone
+	queueMessage := string(config.QueueMessageMode)
+
+	configFile := os.Getenv("CONFIG_FILE")
+	required := configFile != ""
+	if configFile == "" {
+		configFile = defaultConfigFile
+	}
+	if err := config.applyFile(configFile, &timeZone, &queueMessage); err != nil {
+		if required || !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	} else {
+		log.Printf("Loaded configuration from %s", configFile)
 	}
 
-	chatIDStr := os.Getenv("QUEUE_CHAT_ID")
-	if chatIDStr == "" {
-		return nil, fmt.Errorf("QUEUE_CHAT_ID environment variable is not set")
+	if err := config.applyEnv(&timeZone, &queueMessage); err != nil {
+		return nil, err
 	}
 
+	mode, ok := parseQueueMessageMode(queueMessage)
+	if !ok {
+		return nil, fmt.Errorf("invalid queue message mode %q (supported: %s, %s)", queueMessage, QueueMessageSeparate, QueueMessageInline)
+	}
+	config.QueueMessageMode = mode
+
 	var err error
-	config.QueueChatID, err = strconv.ParseInt(chatIDStr, 10, 64)
+	config.Location, err = time.LoadLocation(timeZone)
 	if err != nil {
-		return nil, fmt.Errorf("invalid QUEUE_CHAT_ID: %w", err)
+		return nil, fmt.Errorf("invalid time zone %q: %w", timeZone, err)
+	}
+	return config, nil
+}
+
+func setIfNotEmpty(dst *string, value string) {
+	if value != "" {
+		*dst = value
 	}
+}
 
-	config.GoogleSheetsID = os.Getenv("GOOGLE_SHEETS_ID")
-	if config.GoogleSheetsID == "" {
-		return nil, fmt.Errorf("GOOGLE_SHEETS_ID environment variable is not set")
+func setIfPositive(dst *time.Duration, value time.Duration) {
+	if value > 0 {
+		*dst = value
 	}
+}
 
-	config.GoogleCredentialsFile = os.Getenv("GOOGLE_CREDENTIALS_FILE")
-	config.GoogleCredentialsJSON = os.Getenv("GOOGLE_CREDENTIALS_JSON")
+func (c *Config) applyFile(filename string, timeZone, queueMessage *string) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("error reading config %s: %w", filename, err)
+	}
 
-	if config.GoogleCredentialsFile == "" && config.GoogleCredentialsJSON == "" {
-		return nil, fmt.Errorf("either GOOGLE_CREDENTIALS_FILE or GOOGLE_CREDENTIALS_JSON must be set")
+	var file fileConfig
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil {
+		return fmt.Errorf("error parsing config %s: %w", filename, err)
 	}
 
-	return config, nil
+	c.TelegramBotToken = file.Telegram.Token
+	c.AdminIDs = file.Telegram.AdminIDs
+	if file.Telegram.SendRateGlobal != 0 {
+		c.SendRateGlobal = file.Telegram.SendRateGlobal
+	}
+	if file.Telegram.SendRateChat != 0 {
+		c.SendRateChat = file.Telegram.SendRateChat
+	}
+
+	switch len(file.Groups) {
+	case 0:
+	case 1:
+		group := file.Groups[0]
+		c.GroupName = group.Name
+		c.QueueChatID = group.ChatID
+		setIfNotEmpty(timeZone, group.TimeZone)
+		setIfNotEmpty(&c.SubjectsFile, group.Schedule)
+		setIfNotEmpty(&c.ScheduleICSFile, group.ScheduleICS)
+		setIfNotEmpty(&c.ScheduleMappingFile, group.ScheduleMapping)
+		setIfNotEmpty(&c.Language, group.Language)
+		setIfNotEmpty(&c.MessagesFile, group.Messages)
+		setIfNotEmpty(queueMessage, group.QueueMessage)
+		if group.AnnounceJoins != nil {
+			c.AnnounceJoins = *group.AnnounceJoins
+		}
+		if group.PinMessages != nil {
+			c.PinMessages = *group.PinMessages
+		}
+	default:
+		return fmt.Errorf("config %s: %d groups configured, but one bot instance serves a single group; run one instance per group", filename, len(file.Groups))
+	}
+
+	c.GoogleSheetsID = file.Google.SheetsID
+	c.GoogleCredentialsFile = file.Google.CredentialsFile
+	c.GoogleCredentialsJSON = file.Google.CredentialsJSON
+	c.ArchiveToSheets = file.Google.ArchiveToSheets
+	setIfNotEmpty(&c.SheetsLastColumn, strings.ToUpper(file.Google.LastColumn))
+
+	setIfNotEmpty(&c.StorageBackend, file.Storage.Backend)
+	setIfNotEmpty(&c.HistoryFile, file.Storage.HistoryFile)
+	setIfNotEmpty(&c.SubscriptionsFile, file.Storage.SubscriptionsFile)
+	setIfNotEmpty(&c.DebtsFile, file.Storage.DebtsFile)
+	setIfNotEmpty(&c.LabsFile, file.Storage.LabsFile)
+	setIfNotEmpty(&c.ProgressFile, file.Storage.ProgressFile)
+	setIfNotEmpty(&c.QueueMessagesFile, file.Storage.QueueMessagesFile)
+	setIfNotEmpty(&c.UserMappingFile, file.Storage.UserMappingFile)
+	setIfNotEmpty(&c.OverridesFile, file.Storage.OverridesFile)
+	setIfNotEmpty(&c.StateFile, file.Storage.StateFile)
+
+	setIfPositive(&c.RegistrationWindow, file.Timing.RegistrationWindow)
+	setIfPositive(&c.LotteryWindow, file.Timing.LotteryWindow)
+	setIfPositive(&c.NotificationDedupe, file.Timing.NotificationDedupe)
+	setIfPositive(&c.StaleOperationTimeout, file.Timing.StaleOperation)
+	setIfPositive(&c.SwapRequestTTL, file.Timing.SwapRequestTTL)
+	if file.Timing.QueueEditDelay != 0 {
+		c.QueueEditDelay = file.Timing.QueueEditDelay
+	}
+
+	c.CalendarAddr = file.Calendar.Addr
+	c.CalendarURL = file.Calendar.URL
+	return nil
+}
+
+func envString(key string, dst *string) {
+	if value := os.Getenv(key); value != "" {
+		*dst = value
+	}
+}
+
+func envInt64(key string, dst *int64) error {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return nil
+	}
+	parsed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", key, err)
+	}
+	*dst = parsed
+	return nil
+}
+
+func envInt(key string, dst *int) error {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return nil
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", key, err)
+	}
+	*dst = parsed
+	return nil
+}
+
+func envBool(key string, dst *bool) error {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return nil
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", key, err)
+	}
+	*dst = parsed
+	return nil
+}
+
+func envDuration(key string, dst *time.Duration) error {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return nil
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", key, err)
+	}
+	*dst = parsed
+	return nil
+}
+
+func (c *Config) applyEnv(timeZone, queueMessage *string) error {
+	envString("TELEGRAM_BOT_TOKEN", &c.TelegramBotToken)
+	envString("GROUP_NAME", &c.GroupName)
+	envString("LANGUAGE", &c.Language)
+	envString("MESSAGES_FILE", &c.MessagesFile)
+	envString("GOOGLE_SHEETS_ID", &c.GoogleSheetsID)
+	envString("GOOGLE_CREDENTIALS_FILE", &c.GoogleCredentialsFile)
+	envString("GOOGLE_CREDENTIALS_JSON", &c.GoogleCredentialsJSON)
+	envString("SHEETS_LAST_COLUMN", &c.SheetsLastColumn)
+	envString("STORAGE_BACKEND", &c.StorageBackend)
+	envString("HISTORY_FILE", &c.HistoryFile)
+	envString("SUBSCRIPTIONS_FILE", &c.SubscriptionsFile)
+	envString("DEBTS_FILE", &c.DebtsFile)
+	envString("LABS_FILE", &c.LabsFile)
+	envString("PROGRESS_FILE", &c.ProgressFile)
+	envString("QUEUE_MESSAGES_FILE", &c.QueueMessagesFile)
+	envString("USER_MAPPING_FILE", &c.UserMappingFile)
+	envString("SCHEDULE_OVERRIDES_FILE", &c.OverridesFile)
+	envString("STATE_FILE", &c.StateFile)
+	envString("CALENDAR_ADDR", &c.CalendarAddr)
+	envString("CALENDAR_URL", &c.CalendarURL)
+	envString("TIME_ZONE", timeZone)
+	envString("QUEUE_MESSAGE_MODE", queueMessage)
+	envString("SUBJECTS_FILE", &c.SubjectsFile)
+	envString("SCHEDULE_ICS_FILE", &c.ScheduleICSFile)
+	envString("SCHEDULE_MAPPING_FILE", &c.ScheduleMappingFile)
+	c.SheetsLastColumn = strings.ToUpper(c.SheetsLastColumn)
+
+	if err := envInt64("QUEUE_CHAT_ID", &c.QueueChatID); err != nil {
+		return err
+	}
+	if err := envBool("ARCHIVE_TO_SHEETS", &c.ArchiveToSheets); err != nil {
+		return err
+	}
+	if err := envBool("ANNOUNCE_JOINS", &c.AnnounceJoins); err != nil {
+		return err
+	}
+	if err := envBool("PIN_MESSAGES", &c.PinMessages); err != nil {
+		return err
+	}
+	if err := envInt("SEND_RATE_GLOBAL", &c.SendRateGlobal); err != nil {
+		return err
+	}
+	if err := envInt("SEND_RATE_CHAT", &c.SendRateChat); err != nil {
+		return err
+	}
+
+	durations := []struct {
+		key string
+		dst *time.Duration
+	}{
+		{"REGISTRATION_WINDOW", &c.RegistrationWindow},
+		{"LOTTERY_WINDOW", &c.LotteryWindow},
+		{"NOTIFICATION_DEDUPE", &c.NotificationDedupe},
+		{"STALE_OPERATION_TIMEOUT", &c.StaleOperationTimeout},
+		{"SWAP_REQUEST_TTL", &c.SwapRequestTTL},
+		{"QUEUE_EDIT_DELAY", &c.QueueEditDelay},
+	}
+	for _, d := range durations {
+		if err := envDuration(d.key, d.dst); err != nil {
+			return err
+		}
+	}
+
+	if adminIDsStr, ok := os.LookupEnv("ADMIN_IDS"); ok {
+		c.AdminIDs = nil
+		for _, idStr := range strings.Split(adminIDsStr, ",") {
+			idStr = strings.TrimSpace(idStr)
+			if idStr == "" {
+				continue
+			}
+			adminID, err := strconv.ParseInt(idStr, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid ADMIN_IDS entry %q: %w", idStr, err)
+			}
+			c.AdminIDs = append(c.AdminIDs, adminID)
+		}
+	}
+
+	return nil
+}
+
+// validate reports every configuration problem at once.
+func (c *Config) validate() error {
+	return errors.Join(c.validateCredentials(), c.validateSettings())
+}
+
+func (c *Config) validateCredentials() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.TelegramBotToken != "", "TELEGRAM_BOT_TOKEN (telegram.token) is not set")
+	check(c.QueueChatID != 0, "QUEUE_CHAT_ID (groups[0].chat_id) is not set")
+	check(c.GoogleSheetsID != "", "GOOGLE_SHEETS_ID (google.sheets_id) is not set")
+	check(c.GoogleCredentialsFile != "" || c.GoogleCredentialsJSON != "",
+		"either GOOGLE_CREDENTIALS_FILE or GOOGLE_CREDENTIALS_JSON must be set")
+
+	return errors.Join(errs...)
+}
+
+func (c *Config) validateSettings() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(sheetColumnPattern.MatchString(c.SheetsLastColumn),
+		"SHEETS_LAST_COLUMN must be a column letter like Z or ZZ, got %q", c.SheetsLastColumn)
+	check(isSupportedLanguage(c.Language), "unsupported language %q (supported: ru, en)", c.Language)
+	check(c.StorageBackend == storageBackendJSON,
+		"unsupported storage backend %q (supported: %s)", c.StorageBackend, storageBackendJSON)
+
+	check(c.RegistrationWindow > 0, "REGISTRATION_WINDOW must be positive")
+	check(c.LotteryWindow > 0 && c.LotteryWindow <= c.RegistrationWindow,
+		"LOTTERY_WINDOW must be between 0 and %v", c.RegistrationWindow)
+	check(c.NotificationDedupe > 0, "NOTIFICATION_DEDUPE must be positive")
+	check(c.StaleOperationTimeout > 0, "STALE_OPERATION_TIMEOUT must be positive")
+	check(c.SwapRequestTTL > 0, "SWAP_REQUEST_TTL must be positive")
+	check(c.QueueEditDelay >= 0, "QUEUE_EDIT_DELAY must not be negative")
+	check(c.SendRateGlobal > 0, "SEND_RATE_GLOBAL must be positive")
+	check(c.SendRateChat > 0, "SEND_RATE_CHAT must be positive")
+
+	for _, adminID := range c.AdminIDs {
+		check(adminID > 0, "invalid admin ID %d", adminID)
+	}
+
+	return errors.Join(errs...)
 }
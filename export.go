@@ -0,0 +1,408 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const exportDateLayout = "2006-01-02"
+
+type ExportFormat string
+
+const (
+	ExportCSV  ExportFormat = "csv"
+	ExportJSON ExportFormat = "json"
+	ExportXLSX ExportFormat = "xlsx"
+)
+
+func parseExportFormat(s string) (ExportFormat, error) {
+	switch format := ExportFormat(strings.ToLower(s)); format {
+	case ExportCSV, ExportJSON, ExportXLSX:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unknown export format %q (expected csv, json or xlsx)", s)
+	}
+}
+
+// ExportRow is a single queue entry of an archived session.
+type ExportRow struct {
+	Date       string `json:"date"`
+	Subject    string `json:"subject"`
+	SessionID  string `json:"session_id"`
+	Position   int    `json:"position,omitempty"`
+	Student    string `json:"student"`
+	Note       string `json:"note,omitempty"`
+	Status     string `json:"status"`
+	Presented  bool   `json:"presented"`
+	JoinedAt   string `json:"joined_at,omitempty"`
+	CalledAt   string `json:"called_at,omitempty"`
+	FinishedAt string `json:"finished_at,omitempty"`
+	LeftAt     string `json:"left_at,omitempty"`
+}
+
+var exportColumns = []string{"date", "subject", "session", "position", "student", "note", "status", "presented", "joined_at", "called_at", "finished_at", "left_at"}
+
+func exportHeader(messages *Messages) []string {
+	header := make([]string, len(exportColumns))
+	for i, column := range exportColumns {
+		header[i] = messages.Plain("column."+column, nil)
+	}
+	return header
+}
+
+func (r ExportRow) values(messages *Messages) []string {
+	position := ""
+	if r.Position > 0 {
+		position = fmt.Sprintf("%d", r.Position)
+	}
+	presented := messages.Plain("export.no", nil)
+	if r.Presented {
+		presented = messages.Plain("export.yes", nil)
+	}
+	return []string{r.Date, r.Subject, r.SessionID, position, r.Student, r.Note, r.Status, presented, r.JoinedAt, r.CalledAt, r.FinishedAt, r.LeftAt}
+}
+
+func exportTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+func exportRow(session ArchivedSession, entry QueueEntry, position int, status string) ExportRow {
+	return ExportRow{
+		Date:       session.Start.In(getLocation()).Format(exportDateLayout),
+		Subject:    session.Subject.Name,
+		SessionID:  session.ID,
+		Position:   position,
+		Student:    entry.Name,
+		Note:       entry.Note,
+		Status:     status,
+		Presented:  entry.Status == EntryPresented,
+		JoinedAt:   exportTime(entry.JoinedAt),
+		CalledAt:   exportTime(entry.CalledAt),
+		FinishedAt: exportTime(entry.FinishedAt),
+		LeftAt:     exportTime(entry.LeftAt),
+	}
+}
+
+func buildExportRows(messages *Messages, sessions []ArchivedSession) []ExportRow {
+	rows := make([]ExportRow, 0)
+	for _, session := range sessions {
+		for i, entry := range session.Queue {
+			rows = append(rows, exportRow(session, entry, i+1, messages.entryStatusLabel(entry.Status)))
+		}
+		for _, entry := range session.Waitlist {
+			rows = append(rows, exportRow(session, entry, 0, messages.Plain("status.waitlisted", nil)))
+		}
+		for _, entry := range session.Departed {
+			rows = append(rows, exportRow(session, entry, 0, messages.Plain("status.left", nil)))
+		}
+	}
+	return rows
+}
+
+// filterArchivedSessions keeps sessions starting within [from, to]; zero
+// bounds are open.
+func filterArchivedSessions(sessions []ArchivedSession, from, to time.Time) []ArchivedSession {
+	result := make([]ArchivedSession, 0, len(sessions))
+	for _, session := range sessions {
+		if !from.IsZero() && session.Start.Before(from) {
+			continue
+		}
+		if !to.IsZero() && !session.Start.Before(to) {
+			continue
+		}
+		result = append(result, session)
+	}
+	return result
+}
+
+func writeExport(w io.Writer, messages *Messages, format ExportFormat, rows []ExportRow) error {
+	switch format {
+	case ExportCSV:
+		return writeExportCSV(w, messages, rows)
+	case ExportJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(rows)
+	case ExportXLSX:
+		return writeExportXLSX(w, messages, rows)
+	default:
+		return fmt.Errorf("unknown export format %q", format)
+	}
+}
+
+func writeExportCSV(w io.Writer, messages *Messages, rows []ExportRow) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(exportHeader(messages)); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if err := writer.Write(row.values(messages)); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+const (
+	xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`
+	xlsxRootRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`
+	xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets></workbook>`
+	xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`
+)
+
+// writeExportXLSX writes a minimal single-sheet workbook using inline strings,
+// which is enough for Excel, LibreOffice and Google Sheets.
+func writeExportXLSX(w io.Writer, messages *Messages, rows []ExportRow) error {
+	var sheet bytes.Buffer
+	sheet.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n")
+	sheet.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+
+	writeRow := func(rowNum int, values []string) error {
+		fmt.Fprintf(&sheet, `<row r="%d">`, rowNum)
+		for col, value := range values {
+			if value == "" {
+				continue
+			}
+			fmt.Fprintf(&sheet, `<c r="%s%d" t="inlineStr"><is><t xml:space="preserve">`, numberToColumnLetter(col+1), rowNum)
+			if err := xml.EscapeText(&sheet, []byte(value)); err != nil {
+				return err
+			}
+			sheet.WriteString(`</t></is></c>`)
+		}
+		sheet.WriteString(`</row>`)
+		return nil
+	}
+
+	if err := writeRow(1, exportHeader(messages)); err != nil {
+		return err
+	}
+	for i, row := range rows {
+		if err := writeRow(i+2, row.values(messages)); err != nil {
+			return err
+		}
+	}
+	sheet.WriteString(`</sheetData></worksheet>`)
+
+	var sheetName bytes.Buffer
+	if err := xml.EscapeText(&sheetName, []byte(messages.Plain("export.sheet_name", nil))); err != nil {
+		return err
+	}
+
+	archive := zip.NewWriter(w)
+	files := []struct {
+		name    string
+		content []byte
+	}{
+		{"[Content_Types].xml", []byte(xlsxContentTypes)},
+		{"_rels/.rels", []byte(xlsxRootRels)},
+		{"xl/workbook.xml", []byte(fmt.Sprintf(xlsxWorkbook, sheetName.String()))},
+		{"xl/_rels/workbook.xml.rels", []byte(xlsxWorkbookRels)},
+		{"xl/worksheets/sheet1.xml", sheet.Bytes()},
+	}
+	for _, file := range files {
+		fw, err := archive.Create(file.name)
+		if err != nil {
+			return fmt.Errorf("error creating %s: %w", file.name, err)
+		}
+		if _, err := fw.Write(file.content); err != nil {
+			return fmt.Errorf("error writing %s: %w", file.name, err)
+		}
+	}
+	return archive.Close()
+}
+
+// parseExportRange parses optional from/to dates; the end date is inclusive.
+func parseExportRange(fromStr, toStr string) (time.Time, time.Time, error) {
+	var from, to time.Time
+	var err error
+	if fromStr != "" {
+		from, err = time.ParseInLocation(exportDateLayout, fromStr, getLocation())
+		if err != nil {
+			return from, to, fmt.Errorf("invalid start date %q: %w", fromStr, err)
+		}
+	}
+	if toStr != "" {
+		to, err = time.ParseInLocation(exportDateLayout, toStr, getLocation())
+		if err != nil {
+			return from, to, fmt.Errorf("invalid end date %q: %w", toStr, err)
+		}
+		to = to.AddDate(0, 0, 1)
+	}
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		return from, to, fmt.Errorf("start date %s is after end date %s", fromStr, toStr)
+	}
+	return from, to, nil
+}
+
+func exportFileName(subjectCode string, format ExportFormat) string {
+	if subjectCode == "" {
+		subjectCode = "all"
+	}
+	return fmt.Sprintf("queue_history_%s_%s.%s", subjectCode, getLocalTime().Format(exportDateLayout), format)
+}
+
+func (ns *NotificationService) handleExportCommand(message *tgbotapi.Message) {
+	if !ns.isAdmin(ns.config.QueueChatID, message.From.ID) {
+		ns.reply(message, ns.t("export.admin_only", nil))
+		return
+	}
+
+	args := strings.Fields(message.CommandArguments())
+	if len(args) == 0 {
+		ns.reply(message, ns.t("export.usage", nil))
+		return
+	}
+
+	subjectName, subjectCode := "", ""
+	if !strings.EqualFold(args[0], "all") {
+		subjectName = ns.findSubjectByShortCode(args[0])
+		if subjectName == "" {
+			ns.reply(message, ns.t("common.subject_not_found", vars{"Code": args[0]}))
+			return
+		}
+		subjectCode = args[0]
+	}
+
+	format := ExportCSV
+	var dates []string
+	for _, arg := range args[1:] {
+		if parsed, err := parseExportFormat(arg); err == nil {
+			format = parsed
+			continue
+		}
+		dates = append(dates, arg)
+	}
+	if len(dates) > 2 {
+		ns.reply(message, ns.t("export.too_many_dates", nil))
+		return
+	}
+	dates = append(dates, "", "")
+
+	from, to, err := parseExportRange(dates[0], dates[1])
+	if err != nil {
+		ns.reply(message, ns.t("export.bad_date", nil))
+		return
+	}
+
+	sessions := filterArchivedSessions(ns.historyStore.GetSessions(subjectName), from, to)
+	if len(sessions) == 0 {
+		ns.reply(message, ns.t("export.empty", nil))
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := writeExport(&buf, ns.messages, format, buildExportRows(ns.messages, sessions)); err != nil {
+		log.Printf("Error exporting history: %v", err)
+		ns.reply(message, ns.t("export.failed", nil))
+		return
+	}
+
+	doc := tgbotapi.NewDocument(message.Chat.ID, tgbotapi.FileBytes{
+		Name:  exportFileName(subjectCode, format),
+		Bytes: buf.Bytes(),
+	})
+	doc.Caption = ns.t("export.caption", vars{"Sessions": len(sessions)})
+	doc.ParseMode = parseModeHTML
+	if _, err := ns.bot.Send(doc); err != nil {
+		log.Printf("Error sending export: %v", err)
+	}
+}
+
+// runExportCLI implements `queue-bot export`, which reads the history file
+// directly and does not need Telegram or Sheets credentials.
+func runExportCLI(args []string) error {
+	config, err := LoadOfflineConfig()
+	if err != nil {
+		return err
+	}
+	setLocation(config.Location)
+
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	subjectCode := flags.String("subject", "", "subject short code (empty for all subjects)")
+	fromStr := flags.String("from", "", "first date, YYYY-MM-DD")
+	toStr := flags.String("to", "", "last date (inclusive), YYYY-MM-DD")
+	formatStr := flags.String("format", "csv", "output format: csv, json or xlsx")
+	output := flags.String("out", "", "output file (default stdout)")
+	historyFile := flags.String("history", config.HistoryFile, "history file")
+	subjectsFile := flags.String("subjects", "", "schedule file used to resolve subject codes (default from the configuration)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	format, err := parseExportFormat(*formatStr)
+	if err != nil {
+		return err
+	}
+	from, to, err := parseExportRange(*fromStr, *toStr)
+	if err != nil {
+		return err
+	}
+
+	historyStore, err := NewHistoryStore(*historyFile)
+	if err != nil {
+		return err
+	}
+
+	subjectName := ""
+	if *subjectCode != "" {
+		if *subjectsFile != "" {
+			config.SubjectsFile = *subjectsFile
+			config.ScheduleICSFile = ""
+		}
+		queueManager := NewQueueManager()
+		if err := loadSchedule(queueManager, config); err != nil {
+			return err
+		}
+		subjectName = queueManager.FindSubjectByShortCode(*subjectCode)
+		if subjectName == "" {
+			return fmt.Errorf("unknown subject %q", *subjectCode)
+		}
+	}
+
+	messages, err := LoadMessages(config.Language, config.MessagesFile)
+	if err != nil {
+		return err
+	}
+
+	rows := buildExportRows(messages, filterArchivedSessions(historyStore.GetSessions(subjectName), from, to))
+
+	if *output == "" {
+		if err := writeExport(os.Stdout, messages, format, rows); err != nil {
+			return fmt.Errorf("error writing export: %w", err)
+		}
+	} else {
+		file, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("error creating %s: %w", *output, err)
+		}
+		if err := writeExport(file, messages, format, rows); err != nil {
+			file.Close()
+			return fmt.Errorf("error writing export: %w", err)
+		}
+		if err := file.Close(); err != nil {
+			return fmt.Errorf("error closing %s: %w", *output, err)
+		}
+	}
+	log.Printf("Exported %d rows", len(rows))
+	return nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+type ArchivedSession struct {
+	Session
+	ArchivedAt time.Time `json:"archived_at"`
+}
+
+type HistoryStore struct {
+	mu       sync.RWMutex
+	filename string
+	sessions []ArchivedSession
+}
+
+func NewHistoryStore(filename string) (*HistoryStore, error) {
+	hs := &HistoryStore{
+		filename: filename,
+		sessions: make([]ArchivedSession, 0),
+	}
+
+	if err := loadJSONFile(filename, &hs.sessions); err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("error loading history from %s: %w", filename, err)
+		}
+		log.Printf("History file %s not found, starting with empty history", filename)
+	}
+
+	log.Printf("Loaded %d archived sessions", len(hs.sessions))
+	return hs, nil
+}
+
+func (hs *HistoryStore) Archive(session Session) error {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	archived := ArchivedSession{Session: session, ArchivedAt: time.Now()}
+
+	replaced := false
+	for i := range hs.sessions {
+		if hs.sessions[i].ID == session.ID {
+			hs.sessions[i] = archived
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		hs.sessions = append(hs.sessions, archived)
+	}
+
+	if err := saveJSONFile(hs.filename, hs.sessions); err != nil {
+		return fmt.Errorf("error saving history to %s: %w", hs.filename, err)
+	}
+
+	log.Printf("🗄️  Сессия %s заархивирована (%d в очереди, %d вышли)", session.ID, len(session.Queue), len(session.Departed))
+	return nil
+}
+
+func (hs *HistoryStore) GetSessions(subjectName string) []ArchivedSession {
+	hs.mu.RLock()
+	defer hs.mu.RUnlock()
+
+	result := make([]ArchivedSession, 0)
+	for _, archived := range hs.sessions {
+		if subjectName == "" || archived.Subject.Name == subjectName {
+			result = append(result, archived)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Start.Before(result[j].Start)
+	})
+	return result
+}
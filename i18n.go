@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html"
+	"html/template"
+	"log"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const defaultLanguage = "ru"
+
+//go:embed locales/*.yaml
+var localeFiles embed.FS
+
+// vars carries template data for a message.
+type vars = map[string]any
+
+// Messages is the catalog of user-facing texts for one language. Every text
+// is an html/template executed with vars and rendered as Telegram HTML.
+type Messages struct {
+	language  string
+	templates map[string]*template.Template
+
+	// mentionLink renders a student's name in queue lists; it is set by
+	// the notification service once user IDs can be resolved.
+	mentionLink func(realName string) template.HTML
+}
+
+func (m *Messages) funcs() template.FuncMap {
+	return template.FuncMap{
+		"lastName": extractLastName,
+		"mention":  m.mention,
+		"entry":    m.entry,
+		"inc":      func(i int) int { return i + 1 },
+		"join":     strings.Join,
+		"percent":  func(f float64) string { return fmt.Sprintf("%.0f%%", f*100) },
+		"decimal":  func(f float64) string { return fmt.Sprintf("%.1f", f) },
+	}
+}
+
+func (m *Messages) mention(realName string) template.HTML {
+	if m.mentionLink != nil {
+		return m.mentionLink(realName)
+	}
+	return template.HTML(html.EscapeString(extractLastName(realName)))
+}
+
+// entry renders a queue entry: the student as a mention and their note.
+func (m *Messages) entry(entry QueueEntry) template.HTML {
+	name := m.mention(entry.Name)
+	if entry.Note == "" {
+		return name
+	}
+	return name + template.HTML(" — "+html.EscapeString(entry.Note))
+}
+
+func isSupportedLanguage(language string) bool {
+	_, err := localeFiles.ReadFile("locales/" + language + ".yaml")
+	return err == nil
+}
+
+func readLocale(language string) (map[string]string, error) {
+	data, err := localeFiles.ReadFile("locales/" + language + ".yaml")
+	if err != nil {
+		return nil, fmt.Errorf("unsupported language %q", language)
+	}
+	texts := make(map[string]string)
+	if err := yaml.Unmarshal(data, &texts); err != nil {
+		return nil, fmt.Errorf("error parsing locale %s: %w", language, err)
+	}
+	return texts, nil
+}
+
+// LoadMessages builds the catalog for a language on top of the Russian base
+// texts, then applies wording overrides from overridesFile if it is set.
+func LoadMessages(language, overridesFile string) (*Messages, error) {
+	texts, err := readLocale(defaultLanguage)
+	if err != nil {
+		return nil, err
+	}
+
+	if language != defaultLanguage {
+		localized, err := readLocale(language)
+		if err != nil {
+			return nil, err
+		}
+		for key, text := range localized {
+			if _, known := texts[key]; !known {
+				return nil, fmt.Errorf("locale %s: unknown message %q", language, key)
+			}
+			texts[key] = text
+		}
+	}
+
+	if overridesFile != "" {
+		overrides := make(map[string]string)
+		if err := loadYAMLFile(overridesFile, &overrides); err != nil {
+			return nil, fmt.Errorf("error loading messages %s: %w", overridesFile, err)
+		}
+		for key, text := range overrides {
+			if _, known := texts[key]; !known {
+				return nil, fmt.Errorf("%s: unknown message %q", overridesFile, key)
+			}
+			texts[key] = text
+		}
+		log.Printf("Loaded %d message overrides from %s", len(overrides), overridesFile)
+	}
+
+	messages := &Messages{language: language, templates: make(map[string]*template.Template, len(texts))}
+	var errs []string
+	for key, text := range texts {
+		tmpl, err := template.New(key).Funcs(messages.funcs()).Option("missingkey=zero").Parse(text)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		messages.templates[key] = tmpl
+	}
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return nil, fmt.Errorf("invalid message templates:\n%s", strings.Join(errs, "\n"))
+	}
+
+	return messages, nil
+}
+
+func (m *Messages) Language() string {
+	return m.language
+}
+
+// Text renders a message as Telegram HTML. Unknown keys and template errors are logged and
+// the key itself is returned so the problem is visible but not fatal.
+func (m *Messages) Text(key string, data any) string {
+	tmpl, exists := m.templates[key]
+	if !exists {
+		log.Printf("Warning: unknown message %q", key)
+		return key
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		log.Printf("Error rendering message %q: %v", key, err)
+		return key
+	}
+	return buf.String()
+}
+
+// Plain renders a message without markup, for spreadsheets, exports and
+// other places that do not support HTML.
+func (m *Messages) Plain(key string, data any) string {
+	return htmlToPlain(m.Text(key, data))
+}
+
+func (ns *NotificationService) t(key string, data any) string {
+	return ns.messages.Text(key, data)
+}
+
+// plain renders a message without markup.
+func (ns *NotificationService) plain(key string, data any) string {
+	return ns.messages.Plain(key, data)
+}
+
+// weekdayName localizes a day abbreviation from the schedule file.
+func (ns *NotificationService) weekdayName(day string) string {
+	weekday := parseWeekday(day)
+	if weekday == -1 {
+		return day
+	}
+	return ns.t(fmt.Sprintf("weekday.%d", int(weekday)), nil)
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func (m *Messages) entryStatusLabel(status EntryStatus) string {
+	switch status {
+	case EntryCalled:
+		return m.Plain("status.called", nil)
+	case EntryPresented:
+		return m.Plain("status.presented", nil)
+	case EntrySkipped:
+		return m.Plain("status.skipped", nil)
+	default:
+		return m.Plain("status.waiting", nil)
+	}
+}
+
+func (ns *NotificationService) isAdmin(chatID int64, userID int64) bool {
+	for _, adminID := range ns.config.AdminIDs {
+		if adminID == userID {
+			return true
+		}
+	}
+
+	member, err := ns.bot.GetChatMember(tgbotapi.GetChatMemberConfig{
+		ChatConfigWithUser: tgbotapi.ChatConfigWithUser{ChatID: chatID, UserID: userID},
+	})
+	if err != nil {
+		log.Printf("Error checking chat member %d in %d: %v", userID, chatID, err)
+		return false
+	}
+	return member.IsCreator() || member.IsAdministrator()
+}
+
+func (ns *NotificationService) buildLiveQueueText(session Session) string {
+	var current, next *QueueEntry
+	if i := session.current(); i >= 0 {
+		current = &session.Queue[i]
+	}
+	if i := session.nextWaiting(); i >= 0 {
+		next = &session.Queue[i]
+	}
+
+	return ns.t("live.text", vars{
+		"Subject": session.Subject.Name,
+		"Queue":   session.Queue,
+		"Current": current,
+		"Next":    next,
+	})
+}
+
+func (ns *NotificationService) liveQueueKeyboard(sessionID string) tgbotapi.InlineKeyboardMarkup {
+	nextButton := tgbotapi.NewInlineKeyboardButtonData(ns.t("live.button_next", nil), fmt.Sprintf("next_%s", sessionID))
+	skipButton := tgbotapi.NewInlineKeyboardButtonData(ns.t("live.button_skip", nil), fmt.Sprintf("skip_%s", sessionID))
+	return tgbotapi.NewInlineKeyboardMarkup([]tgbotapi.InlineKeyboardButton{nextButton, skipButton})
+}
+
+func (ns *NotificationService) startLiveQueue(session Session) {
+	if err := ns.syncQueueFromSheets(session); err != nil {
+		log.Printf("Warning: Could not sync %s before class: %v", session.ID, err)
+	}
+	if synced, exists := ns.queueManager.GetSession(session.ID); exists {
+		session = synced
+	}
+
+	ns.remindOnClassStart(session)
+
+	keyboard := ns.liveQueueKeyboard(session.ID)
+	if _, err := ns.postTracked(ns.config.QueueChatID, session.ID, MessageLive, ns.buildLiveQueueText(session), &keyboard, ns.config.PinMessages); err != nil {
+		log.Printf("Error sending live queue message for %s: %v", session.ID, err)
+		return
+	}
+
+	log.Printf("▶️ Запущен режим живой очереди для %s", session.ID)
+}
+
+func (ns *NotificationService) stopLiveQueue(session Session) {
+	message, exists, err := ns.messageStore.Delete(ns.config.QueueChatID, session.ID, MessageLive)
+	if err != nil {
+		log.Printf("Error forgetting live queue message for %s: %v", session.ID, err)
+	}
+	if !exists {
+		return
+	}
+
+	if message.Pinned {
+		if err := ns.unpinMessage(message.ChatID, message.MessageID); err != nil {
+			log.Printf("Warning: Could not unpin live queue message for %s: %v", session.ID, err)
+		}
+	}
+
+	edit := ns.newEdit(message.ChatID, message.MessageID, ns.buildLiveQueueText(session)+ns.t("live.finished", nil))
+	if _, err := ns.bot.Send(edit); err != nil {
+		log.Printf("Error finalizing live queue message for %s: %v", session.ID, err)
+	}
+}
+
+func (ns *NotificationService) handleLiveQueueAction(callbackQuery *tgbotapi.CallbackQuery) {
+	action, sessionID, _ := strings.Cut(callbackQuery.Data, "_")
+	chatID := callbackQuery.Message.Chat.ID
+
+	if !ns.isAdmin(chatID, callbackQuery.From.ID) {
+		ns.answerCallback(callbackQuery.ID, ns.t("live.admin_only", nil))
+		return
+	}
+
+	status := EntryPresented
+	if action == "skip" {
+		status = EntrySkipped
+	}
+
+	closed, called, err := ns.queueManager.AdvanceQueue(sessionID, status)
+	if err != nil {
+		log.Printf("Error advancing live queue %s: %v", sessionID, err)
+		ns.answerCallback(callbackQuery.ID, ns.t("live.not_running", nil))
+		return
+	}
+
+	if closed != nil {
+		log.Printf("Live queue %s: %s → %s", sessionID, closed.Name, closed.Status)
+	}
+
+	answer := ns.t("live.queue_over", nil)
+	if called != nil {
+		answer = ns.t("live.called", vars{"Name": called.Name})
+
+		ping := ns.newMessage(chatID, ns.t("live.ping", vars{"Mention": ns.mention(called.Name)}))
+		if _, err := ns.bot.Send(ping); err != nil {
+			log.Printf("Error sending turn ping: %v", err)
+		}
+	}
+
+	ns.answerCallback(callbackQuery.ID, answer)
+
+	ns.remindApproachingTurns(sessionID)
+
+	session, exists := ns.queueManager.GetSession(sessionID)
+	if !exists {
+		return
+	}
+
+	message, exists := ns.messageStore.Get(chatID, sessionID, MessageLive)
+	if !exists {
+		message = TrackedMessage{ChatID: chatID, SessionID: sessionID, Kind: MessageLive, MessageID: callbackQuery.Message.MessageID}
+	}
+	keyboard := ns.liveQueueKeyboard(sessionID)
+	if err := ns.editTracked(message, ns.buildLiveQueueText(session), &keyboard); err != nil {
+		log.Printf("Error updating live queue message: %v", err)
+	}
+}
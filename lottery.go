@@ -0,0 +1,86 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"log"
+	"time"
+)
+
+func (ns *NotificationService) registrationCloseTime(subject Subject, start time.Time) time.Time {
+	if subject.Policy != PolicyLottery {
+		return start
+	}
+	return ns.registrationOpenTime(start).Add(ns.config.LotteryWindow)
+}
+
+func newLotterySeed() int64 {
+	var buf [8]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		log.Printf("Warning: crypto/rand unavailable, seeding lottery from clock: %v", err)
+		return time.Now().UnixNano()
+	}
+	return int64(binary.BigEndian.Uint64(buf[:]) >> 1)
+}
+
+func (ns *NotificationService) drawLottery(session Session) {
+	if !session.LotteryDrawnAt.IsZero() || ns.restoreLottery(session) {
+		return
+	}
+
+	unlock := ns.lockSheet(session.Subject.Name)
+	if err := ns.syncQueueFromSheets(session); err != nil {
+		log.Printf("Warning: Could not sync %s before lottery: %v", session.ID, err)
+	}
+
+	seed := newLotterySeed()
+	drawnAt := time.Now()
+	ns.queueManager.MarkLotteryDrawn(session.ID, seed, drawnAt)
+	session.LotterySeed = seed
+	ns.applyOrdering(session)
+	ns.enforceCapacity(session)
+	unlock()
+
+	queue := ns.queueManager.GetQueue(session.ID)
+	result := LotteryResult{Seed: seed, DrawnAt: drawnAt, Queue: queue, Waitlist: ns.queueManager.GetWaitlist(session.ID)}
+	if err := ns.stateStore.SaveLottery(session.ID, result); err != nil {
+		log.Printf("Error saving lottery result for %s: %v", session.ID, err)
+	}
+	log.Printf("🎲 Проведена жеребьёвка для %s (seed %d): %v", session.ID, seed, queue)
+
+	text := ns.t("lottery.result", vars{
+		"Subject":  session.Subject.Name,
+		"Queue":    queue,
+		"Waitlist": ns.queueManager.GetWaitlist(session.ID),
+		"Seed":     seed,
+	})
+
+	msg := ns.newMessage(ns.config.QueueChatID, text)
+	if _, err := ns.bot.Send(msg); err != nil {
+		log.Printf("Error publishing lottery result for %s: %v", session.ID, err)
+	}
+
+	if synced, exists := ns.queueManager.GetSession(session.ID); exists {
+		ns.updateOrCreateQueueMessage(ns.config.QueueChatID, synced)
+	}
+}
+
+// restoreLottery puts back a lottery drawn before a restart, without
+// publishing it again. It reports whether there was one.
+func (ns *NotificationService) restoreLottery(session Session) bool {
+	result, drawn := ns.stateStore.Lottery(session.ID)
+	if !drawn {
+		return false
+	}
+
+	defer ns.lockSheet(session.Subject.Name)()
+	if err := ns.syncQueueFromSheets(session); err != nil {
+		log.Printf("Warning: Could not sync %s before restoring lottery: %v", session.ID, err)
+	}
+	ns.queueManager.MarkLotteryDrawn(session.ID, result.Seed, result.DrawnAt)
+	ns.applyOrdering(session)
+	ns.enforceCapacity(session)
+
+	log.Printf("🎲 Восстановлена жеребьёвка для %s (seed %d)", session.ID, result.Seed)
+	return true
+}
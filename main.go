@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"log"
 	"os"
 	"os/signal"
@@ -12,29 +13,85 @@ import (
 
 func main() {
 	if err := LoadEnv(".env"); err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Fatal("Error loading .env file:", err)
+		}
 		log.Println("Warning: Could not load .env file:", err)
 	}
 
+	if len(os.Args) > 1 && os.Args[1] == "--check-config" {
+		os.Exit(checkConfig(os.Args[2:]))
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "export" {
+		if err := runExportCLI(os.Args[2:]); err != nil {
+			log.Fatal("Error exporting history:", err)
+		}
+		return
+	}
+
 	config, err := LoadConfig()
 	if err != nil {
 		log.Fatal("Error loading config:", err)
 	}
 
+	setLocation(config.Location)
+	log.Printf("Using time zone %s", config.Location)
+
 	queueManager := NewQueueManager()
 
-	if err := queueManager.LoadSubjects("queue_lessons.txt"); err != nil {
+	if err := loadSchedule(queueManager, config); err != nil {
 		log.Fatal("Error loading subjects:", err)
 	}
 
-	if err := queueManager.LoadUserMapping("user_mapping.json"); err != nil {
+	if err := queueManager.LoadScheduleOverrides(config.OverridesFile); err != nil {
+		log.Fatal("Error loading schedule overrides:", err)
+	}
+
+	if err := queueManager.LoadUserMapping(config.UserMappingFile); err != nil {
 		log.Fatal("Error loading user mapping:", err)
 	}
 
-	sheetsService, err := NewSheetsService(config, queueManager)
+	messages, err := LoadMessages(config.Language, config.MessagesFile)
+	if err != nil {
+		log.Fatal("Error loading message templates:", err)
+	}
+
+	sheetsService, err := NewSheetsService(config, queueManager, messages)
 	if err != nil {
 		log.Fatal("Error initializing Google Sheets service:", err)
 	}
 
+	historyStore, err := NewHistoryStore(config.HistoryFile)
+	if err != nil {
+		log.Fatal("Error loading queue history:", err)
+	}
+
+	subscriptionStore, err := NewSubscriptionStore(config.SubscriptionsFile)
+	if err != nil {
+		log.Fatal("Error loading reminder subscriptions:", err)
+	}
+
+	debtSource, err := NewFileDebtSource(config.DebtsFile)
+	if err != nil {
+		log.Fatal("Error loading student debts:", err)
+	}
+
+	progressStore, err := NewProgressStore(config.LabsFile, config.ProgressFile, debtSource)
+	if err != nil {
+		log.Fatal("Error loading lab progress:", err)
+	}
+
+	messageStore, err := NewMessageStore(config.QueueMessagesFile)
+	if err != nil {
+		log.Fatal("Error loading queue messages:", err)
+	}
+
+	stateStore, err := NewStateStore(config.StateFile)
+	if err != nil {
+		log.Fatal("Error loading bot state:", err)
+	}
+
 	if err := sheetsService.RestoreColumnHeaders(); err != nil {
 		log.Printf("Warning: Could not restore column headers: %v", err)
 	}
@@ -47,13 +104,17 @@ func main() {
 	bot.Debug = false
 	log.Printf("Authorized on account %s", bot.Self.UserName)
 
-	notificationService := NewNotificationService(bot, queueManager, sheetsService, config)
+	notificationService := NewNotificationService(NewSender(bot, config), queueManager, sheetsService, historyStore, subscriptionStore, progressStore, messageStore, stateStore, messages, config)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	go notificationService.StartScheduler(ctx)
 
+	if config.CalendarAddr != "" {
+		go notificationService.StartCalendarServer(ctx)
+	}
+
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
@@ -65,6 +126,8 @@ func main() {
 		for update := range updates {
 			if update.CallbackQuery != nil {
 				go notificationService.HandleCallbackQuery(update.CallbackQuery)
+			} else if update.Message != nil {
+				go notificationService.HandleMessage(update.Message)
 			}
 		}
 	}()
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"log"
+	"regexp"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// All chat messages are sent with Telegram's HTML parse mode. Message
+// templates are html/template, so subject names, notes and student names
+// are escaped when they are interpolated; only the markup written in the
+// locale files and mentions built here reach Telegram unescaped.
+const parseModeHTML = tgbotapi.ModeHTML
+
+var htmlTagPattern = regexp.MustCompile(`<[^>]*>`)
+
+// htmlToPlain turns a rendered message into plain text for places that do
+// not support markup: callback answers and calendar files.
+func htmlToPlain(text string) string {
+	return html.UnescapeString(htmlTagPattern.ReplaceAllString(text, ""))
+}
+
+func userLink(userID int64, text string) template.HTML {
+	return template.HTML(fmt.Sprintf(`<a href="tg://user?id=%d">%s</a>`, userID, html.EscapeString(text)))
+}
+
+// userID finds the Telegram ID of a student, either remembered from a
+// button press or taken from their reminder subscription.
+func (ns *NotificationService) userID(realName string) (int64, bool) {
+	if userID, exists := ns.queueManager.GetUserID(realName); exists {
+		return userID, true
+	}
+	if subscription, subscribed := ns.subscriptionStore.FindByRealName(realName); subscribed {
+		return subscription.UserID, true
+	}
+	return 0, false
+}
+
+// mentionLink renders a student's last name as a clickable mention when
+// their Telegram ID is known.
+func (ns *NotificationService) mentionLink(realName string) template.HTML {
+	if userID, found := ns.userID(realName); found {
+		return userLink(userID, extractLastName(realName))
+	}
+	return template.HTML(html.EscapeString(extractLastName(realName)))
+}
+
+// mention addresses a student so that Telegram notifies them.
+func (ns *NotificationService) mention(realName string) template.HTML {
+	if userID, found := ns.userID(realName); found {
+		return userLink(userID, realName)
+	}
+	if username := ns.queueManager.GetUsernameByRealName(realName); username != "" {
+		return template.HTML("@" + html.EscapeString(username))
+	}
+	return template.HTML(html.EscapeString(extractLastName(realName)))
+}
+
+func (ns *NotificationService) newMessage(chatID int64, text string) tgbotapi.MessageConfig {
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = parseModeHTML
+	return msg
+}
+
+func (ns *NotificationService) newEdit(chatID int64, messageID int, text string) tgbotapi.EditMessageTextConfig {
+	edit := tgbotapi.NewEditMessageText(chatID, messageID, text)
+	edit.ParseMode = parseModeHTML
+	return edit
+}
+
+func (ns *NotificationService) answerCallback(callbackID string, text string) {
+	if _, err := ns.bot.Request(tgbotapi.NewCallback(callbackID, htmlToPlain(text))); err != nil {
+		log.Printf("Error answering callback: %v", err)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+)
+
+// MessageKind tells apart the messages the bot keeps editing for a session.
+type MessageKind string
+
+const (
+	// MessageNotification is the "registration is open" message with the
+	// join and leave buttons.
+	MessageNotification MessageKind = "notification"
+	// MessageQueue shows the current queue (or, in inline mode, is the
+	// registration notification itself).
+	MessageQueue MessageKind = "queue"
+	// MessageLive is the live queue control message used during the class.
+	MessageLive MessageKind = "live"
+)
+
+type TrackedMessage struct {
+	ChatID    int64       `json:"chat_id"`
+	SessionID string      `json:"session_id"`
+	Kind      MessageKind `json:"kind"`
+	MessageID int         `json:"message_id"`
+	Pinned    bool        `json:"pinned"`
+}
+
+func (m TrackedMessage) key() string {
+	return trackedMessageKey(m.ChatID, m.SessionID, m.Kind)
+}
+
+func trackedMessageKey(chatID int64, sessionID string, kind MessageKind) string {
+	return fmt.Sprintf("%d/%s/%s", chatID, sessionID, kind)
+}
+
+// MessageStore remembers which chat messages belong to which session so
+// they are edited, not reposted, after a restart.
+type MessageStore struct {
+	mu       sync.RWMutex
+	filename string
+	messages map[string]TrackedMessage
+}
+
+func NewMessageStore(filename string) (*MessageStore, error) {
+	ms := &MessageStore{
+		filename: filename,
+		messages: make(map[string]TrackedMessage),
+	}
+
+	var messages []TrackedMessage
+	if err := loadJSONFile(filename, &messages); err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("error loading queue messages from %s: %w", filename, err)
+		}
+		log.Printf("Queue messages file %s not found, starting with no tracked messages", filename)
+	}
+
+	for _, message := range messages {
+		ms.messages[message.key()] = message
+	}
+
+	log.Printf("Loaded %d tracked queue messages", len(ms.messages))
+	return ms, nil
+}
+
+func (ms *MessageStore) save() error {
+	messages := make([]TrackedMessage, 0, len(ms.messages))
+	for _, message := range ms.messages {
+		messages = append(messages, message)
+	}
+
+	if err := saveJSONFile(ms.filename, messages); err != nil {
+		return fmt.Errorf("error saving queue messages to %s: %w", ms.filename, err)
+	}
+	return nil
+}
+
+func (ms *MessageStore) Get(chatID int64, sessionID string, kind MessageKind) (TrackedMessage, bool) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	message, exists := ms.messages[trackedMessageKey(chatID, sessionID, kind)]
+	return message, exists
+}
+
+func (ms *MessageStore) Set(message TrackedMessage) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.messages[message.key()] = message
+	return ms.save()
+}
+
+// Delete forgets a message and returns what was stored for it.
+func (ms *MessageStore) Delete(chatID int64, sessionID string, kind MessageKind) (TrackedMessage, bool, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	key := trackedMessageKey(chatID, sessionID, kind)
+	message, exists := ms.messages[key]
+	if !exists {
+		return TrackedMessage{}, false, nil
+	}
+
+	delete(ms.messages, key)
+	return message, true, ms.save()
+}
+
+// ForSession lists every tracked message of a session.
+func (ms *MessageStore) ForSession(sessionID string) []TrackedMessage {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	var messages []TrackedMessage
+	for _, message := range ms.messages {
+		if message.SessionID == sessionID {
+			messages = append(messages, message)
+		}
+	}
+	return messages
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"log"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const maxNoteLength = 100
+
+func (qm *QueueManager) SetNote(sessionID, realName, note string) bool {
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+
+	session, exists := qm.sessions[sessionID]
+	if !exists {
+		return false
+	}
+
+	if i := session.position(realName); i >= 0 {
+		session.Queue[i].Note = note
+		return true
+	}
+	if i := session.waitlistPosition(realName); i >= 0 {
+		session.Waitlist[i].Note = note
+		return true
+	}
+	return false
+}
+
+func normalizeNote(note string) string {
+	note = strings.Join(strings.Fields(note), " ")
+	if runes := []rune(note); len(runes) > maxNoteLength {
+		note = string(runes[:maxNoteLength])
+	}
+	return note
+}
+
+func (ns *NotificationService) setNote(session Session, realName, note string) bool {
+	if !ns.queueManager.SetNote(session.ID, realName, note) {
+		return false
+	}
+
+	if ns.queueManager.GetUserPositionInQueue(session.ID, realName) > 0 {
+		if err := ns.sheetsService.WriteNote(session.Subject.Name, extractLastName(realName), note); err != nil {
+			log.Printf("Error writing note for %s to Google Sheets: %v", realName, err)
+		}
+	}
+
+	log.Printf("📝 Заметка %s в %s: %q", realName, session.ID, note)
+	return true
+}
+
+func (ns *NotificationService) handleJoinCommand(message *tgbotapi.Message) {
+	args := strings.Fields(message.CommandArguments())
+	if len(args) == 0 {
+		ns.reply(message, ns.t("note.join_usage", nil))
+		return
+	}
+
+	session, found := ns.resolveSession(args[0])
+	if !found {
+		ns.reply(message, ns.t("common.subject_not_found", vars{"Code": args[0]}))
+		return
+	}
+
+	answer := func(text string) {
+		ns.reply(message, text)
+	}
+	ns.joinQueue(message.From, ns.config.QueueChatID, session, normalizeNote(strings.Join(args[1:], " ")), answer)
+}
+
+func (ns *NotificationService) handleNoteCommand(message *tgbotapi.Message) {
+	user := message.From
+	realName := ns.queueManager.GetUserRealName(user.UserName, user.FirstName, user.LastName)
+	if realName == "" {
+		ns.reply(message, ns.t("common.unknown_user", nil))
+		return
+	}
+
+	session, args, err := ns.findUserSession(strings.Fields(message.CommandArguments()), realName)
+	if err != nil {
+		ns.reply(message, err.Error())
+		return
+	}
+
+	note := normalizeNote(strings.Join(args, " "))
+	unlock := ns.lockSheet(session.Subject.Name)
+	saved := ns.setNote(session, realName, note)
+	unlock()
+	if !saved {
+		ns.reply(message, ns.t("note.not_in_queue", vars{"Subject": session.Subject.Name}))
+		return
+	}
+
+	if note == "" {
+		ns.reply(message, ns.t("note.removed", nil))
+	} else {
+		ns.reply(message, ns.t("note.saved", vars{"Note": note}))
+	}
+
+	ns.updateOrCreateQueueMessage(ns.config.QueueChatID, session)
+}
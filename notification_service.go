@@ -12,26 +12,51 @@ import (
 )
 
 type NotificationService struct {
-	bot               *tgbotapi.BotAPI
+	bot               *Sender
 	queueManager      *QueueManager
-	sheetsService     *SheetsService
+	sheetsService     QueueSheet
+	historyStore      *HistoryStore
+	subscriptionStore *SubscriptionStore
+	progressStore     *ProgressStore
+	messages          *Messages
 	config            *Config
-	sentNotifications map[string]time.Time
-	queueMessageIDs   map[string]int
+	messageStore      *MessageStore
+	stateStore        *StateStore
+	state             *serviceState
 	activeOperations  map[string]time.Time
 	operationsMutex   sync.Mutex
+	swapRequests      map[string]SwapRequest
+	swapCounter       int64
+	swapMutex         sync.Mutex
+	queueUpdates      map[string]bool
+	queueUpdatesMutex sync.Mutex
+	queueMessageMutex sync.Mutex
+	sheetLocks        map[string]*sync.Mutex
+	sheetLocksMutex   sync.Mutex
 }
 
-func NewNotificationService(bot *tgbotapi.BotAPI, queueManager *QueueManager, sheetsService *SheetsService, config *Config) *NotificationService {
+func NewNotificationService(bot *Sender, queueManager *QueueManager, sheetsService QueueSheet, historyStore *HistoryStore, subscriptionStore *SubscriptionStore, progressStore *ProgressStore, messageStore *MessageStore, stateStore *StateStore, messages *Messages, config *Config) *NotificationService {
 	ns := &NotificationService{
 		bot:               bot,
 		queueManager:      queueManager,
 		sheetsService:     sheetsService,
+		historyStore:      historyStore,
+		subscriptionStore: subscriptionStore,
+		progressStore:     progressStore,
+		messageStore:      messageStore,
+		stateStore:        stateStore,
+		messages:          messages,
 		config:            config,
-		sentNotifications: make(map[string]time.Time),
-		queueMessageIDs:   make(map[string]int),
+		state:             newServiceState(),
 		activeOperations:  make(map[string]time.Time),
+		swapRequests:      make(map[string]SwapRequest),
+		queueUpdates:      make(map[string]bool),
+		sheetLocks:        make(map[string]*sync.Mutex),
 	}
+	messages.mentionLink = ns.mentionLink
+
+	ns.recoverMissedSessions()
+	ns.scheduleUpcomingSessions()
 
 	log.Println("🔄 Синхронизация очередей с Google Sheets при запуске...")
 	ns.syncAllQueuesFromSheets()
@@ -42,32 +67,19 @@ func NewNotificationService(bot *tgbotapi.BotAPI, queueManager *QueueManager, sh
 }
 
 func (ns *NotificationService) checkOnStartup() {
-
-	now := getMoscowTime()
-	subjects := ns.queueManager.GetSubjects()
-
 	log.Println("🔍 Проверяем предметы при запуске...")
 
-	subjectsFound := 0
-	for _, subject := range subjects {
-		nextSubjectTime := GetNextSubjectTime(subject)
-		if nextSubjectTime == nil {
-			continue
-		}
-
-		timeUntilSubject := nextSubjectTime.Sub(now)
+	ns.advanceSessions()
 
-		if timeUntilSubject > 0 && timeUntilSubject <= 24*time.Hour {
-			log.Printf("📚 Найден предмет в ближайшие 24 часа: %s (через %v)",
-				subject.Name, timeUntilSubject.Round(time.Minute))
-
-			ns.sendQueueNotification(subject)
-			subjectsFound++
+	openSessions := 0
+	for _, session := range ns.queueManager.GetSessions() {
+		if session.State == SessionOpen {
+			openSessions++
 		}
 	}
 
-	if subjectsFound > 0 {
-		log.Printf("✅ Проверка при запуске завершена. Отправлено уведомлений: %d", subjectsFound)
+	if openSessions > 0 {
+		log.Printf("✅ Проверка при запуске завершена. Открытых сессий: %d", openSessions)
 	} else {
 		log.Println("✅ Проверка при запуске завершена. Предметов в ближайшие 24 часа не найдено")
 	}
@@ -87,114 +99,218 @@ func (ns *NotificationService) StartScheduler(ctx context.Context) {
 			log.Println("Notification scheduler stopped")
 			return
 		case <-ticker.C:
-			ns.checkAndSendNotifications()
-			ns.checkAndClearFinishedSubjects()
+			ns.tick()
 		case <-cleanupTicker.C:
 			ns.cleanupOldNotifications()
 		case <-operationsCleanupTicker.C:
 			ns.cleanupStaleOperations()
+			ns.cleanupExpiredSwapRequests()
 		}
 	}
 }
 
-func (ns *NotificationService) checkAndSendNotifications() {
+// tick is the scheduler's periodic step.
+func (ns *NotificationService) tick() {
+	ns.reloadScheduleIfChanged()
+	ns.advanceSessions()
+	ns.checkWeeklySummary()
+}
 
-	now := getMoscowTime()
+func (ns *NotificationService) scheduleUpcomingSessions() {
+	now := getLocalTime()
 	subjects := ns.queueManager.GetSubjects()
 
 	for _, subject := range subjects {
-		nextSubjectTime := GetNextSubjectTime(subject)
-		if nextSubjectTime == nil {
+		startTime := GetNextSubjectTime(subject)
+		endTime := GetNextSubjectEndTime(subject)
+		if startTime == nil || endTime == nil {
 			continue
 		}
 
-		timeUntilSubject := nextSubjectTime.Sub(now)
-		if timeUntilSubject > 23*time.Hour+59*time.Minute && timeUntilSubject < 24*time.Hour+2*time.Minute {
-			ns.sendQueueNotification(subject)
+		previousStart, ok := previousSubjectTime(subject, *startTime)
+		previousEnd := previousStart.Add(endTime.Sub(*startTime))
+		if ok && now.Before(previousEnd) {
+			ns.queueManager.EnsureSession(subject, previousStart, previousEnd, ns.registrationOpenTime(previousStart), ns.registrationCloseTime(subject, previousStart))
 		}
+
+		ns.queueManager.EnsureSession(subject, *startTime, *endTime, ns.registrationOpenTime(*startTime), ns.registrationCloseTime(subject, *startTime))
 	}
 }
 
-func (ns *NotificationService) checkAndClearFinishedSubjects() {
+func (ns *NotificationService) registrationOpenTime(start time.Time) time.Time {
+	return start.Add(-ns.config.RegistrationWindow)
+}
 
-	now := getMoscowTime()
-	subjects := ns.queueManager.GetSubjects()
+func (ns *NotificationService) advanceSessions() {
+	ns.scheduleUpcomingSessions()
 
-	for _, subject := range subjects {
-		endTime := GetNextSubjectEndTime(subject)
-		if endTime != nil && now.After(*endTime) {
-			ns.clearSubjectQueue(subject.Name)
-		}
+	now := getLocalTime()
+	for _, session := range ns.queueManager.GetSessions() {
+		ns.advanceSession(session, now)
 	}
 }
 
-func (ns *NotificationService) sendQueueNotification(subject Subject) {
+func (ns *NotificationService) advanceSession(session Session, now time.Time) {
+	target := session.StateAt(now)
+	for session.State.CanTransitionTo(target) {
+		next, ok := session.State.Next()
+		if !ok {
+			break
+		}
+		if err := ns.queueManager.SetSessionState(session.ID, next); err != nil {
+			log.Printf("Error advancing session %s: %v", session.ID, err)
+			break
+		}
+		session.State = next
+		ns.onSessionStateChanged(session, target)
+	}
+}
 
-	now := getMoscowTime()
+// recoverMissedSessions finishes classes that ended while the bot was down.
+// Their queue is still in the sheet column, where the next class would
+// otherwise take it for its own.
+func (ns *NotificationService) recoverMissedSessions() {
+	now := getLocalTime()
+	for _, active := range ns.stateStore.ActiveSessions() {
+		if now.Before(active.End) {
+			continue
+		}
+		log.Printf("⚠️ Занятие %s закончилось, пока бот был выключен: архивируем очередь", active.ID)
+		session := ns.queueManager.EnsureSession(active.Subject, active.Start, active.End, active.OpensAt, active.ClosesAt)
+		ns.advanceSession(session, now)
+	}
+}
 
-	nextSubjectTime := GetNextSubjectTime(subject)
-	if nextSubjectTime == nil {
-		return
+// onSessionStateChanged runs the side effects of entering a state. target is
+// the state the session is being advanced to, which differs when several
+// states are passed at once.
+func (ns *NotificationService) onSessionStateChanged(session Session, target SessionState) {
+	switch session.State {
+	case SessionOpen:
+		if err := ns.stateStore.SaveActiveSession(session); err != nil {
+			log.Printf("Error saving session %s: %v", session.ID, err)
+		}
+		if !time.Now().Before(session.RegistrationClosesAt()) {
+			return
+		}
+		log.Printf("📚 Открыта запись на %s (начало через %v)",
+			session.Subject.Name, time.Until(session.Start).Round(time.Minute))
+		ns.sendQueueNotification(session)
+	case SessionClosed:
+		log.Printf("🔒 Запись на %s закрыта", session.Subject.Name)
+		if session.Subject.Policy != PolicyLottery {
+			return
+		}
+		// Catching up after downtime: a class that has already started is
+		// not drawn, only a draw made before the restart is put back.
+		if target != SessionClosed {
+			if !ns.restoreLottery(session) {
+				log.Printf("⚠️ Жеребьёвка для %s не проводится: занятие уже началось", session.ID)
+			}
+			return
+		}
+		ns.drawLottery(session)
+	case SessionInProgress:
+		log.Printf("🎓 Занятие %s началось", session.Subject.Name)
+		if target == SessionInProgress {
+			ns.startLiveQueue(session)
+		}
+	case SessionFinished:
+		ns.finishSession(session)
 	}
+}
 
-	notificationKey := fmt.Sprintf("%s_%s", subject.Name, nextSubjectTime.Format("2006-01-02"))
+func (ns *NotificationService) sendQueueNotification(session Session) {
+	now := getLocalTime()
+	subject := session.Subject
 
-	if lastSent, exists := ns.sentNotifications[notificationKey]; exists {
-		if now.Sub(lastSent) < 6*time.Hour {
+	if lastSent, exists := ns.state.notificationSentAt(session.ID); exists {
+		if now.Sub(lastSent) < ns.config.NotificationDedupe {
 			log.Printf("⏭️  Пропускаем уведомление для %s - уже отправлено %v назад",
 				subject.Name, now.Sub(lastSent).Round(time.Minute))
 			return
 		}
 	}
 
-	text := "📚 Открыта запись в очередь на сдачу работ!\n\n"
-	text += fmt.Sprintf("🎓 **%s**\n", subject.Name)
-	text += fmt.Sprintf("📅 %s в %s-%s\n\n", subject.Day, subject.Start, subject.End)
-	text += "Нажмите кнопку ниже, чтобы записаться в очередь:"
-
-	shortCode, exists := ns.queueManager.GetColumnMapping(subject.Name)
-	if !exists {
+	if _, exists := ns.queueManager.GetColumnMapping(subject.Name); !exists {
 		log.Printf("Warning: No short code found for subject: %s", subject.Name)
 		return
 	}
 
-	joinButton := tgbotapi.NewInlineKeyboardButtonData("Записаться", fmt.Sprintf("join_%s", shortCode))
-	leaveButton := tgbotapi.NewInlineKeyboardButtonData("Уйти из очереди", fmt.Sprintf("leave_%s", shortCode))
-	keyboard := tgbotapi.NewInlineKeyboardMarkup([]tgbotapi.InlineKeyboardButton{joinButton, leaveButton})
+	// In inline mode the notification is the queue message itself.
+	kind := MessageNotification
+	if ns.config.QueueMessageMode == QueueMessageInline {
+		kind = MessageQueue
+	}
+	keyboard := ns.joinKeyboard(session.ID)
 
-	msg := tgbotapi.NewMessage(ns.config.QueueChatID, text)
-	msg.ParseMode = "Markdown"
-	msg.ReplyMarkup = keyboard
+	// Posted before a restart: bring that message up to date instead.
+	if message, exists := ns.messageStore.Get(ns.config.QueueChatID, session.ID, kind); exists {
+		if err := ns.editTracked(message, ns.queueMessageText(session), &keyboard); err != nil {
+			log.Printf("Error updating queue notification for %s: %v", subject.Name, err)
+			return
+		}
+		ns.state.recordNotification(session.ID, now)
+		log.Printf("✅ Queue notification for session %s is already posted", session.ID)
+		return
+	}
 
-	if _, err := ns.bot.Send(msg); err != nil {
+	if _, err := ns.postTracked(ns.config.QueueChatID, session.ID, kind, ns.queueMessageText(session), &keyboard, ns.config.PinMessages); err != nil {
 		log.Printf("Error sending queue notification for %s: %v", subject.Name, err)
 		return
 	}
 
-	ns.sentNotifications[notificationKey] = now
+	ns.state.recordNotification(session.ID, now)
 
-	log.Printf("✅ Sent queue notification for subject: %s", subject.Name)
+	log.Printf("✅ Sent queue notification for session: %s", session.ID)
 }
 
-func (ns *NotificationService) clearSubjectQueue(subjectName string) {
-	ns.queueManager.ClearQueue(subjectName)
+func (ns *NotificationService) finishSession(session Session) {
+	subjectName := session.Subject.Name
+	ns.releaseSessionMessages(session.ID)
+	ns.stopLiveQueue(session)
+	ns.state.forgetReminders(session.ID)
+
+	if err := ns.syncQueueFromSheets(session); err != nil {
+		log.Printf("Warning: Could not sync %s before archiving: %v", session.ID, err)
+	}
+	if synced, exists := ns.queueManager.GetSession(session.ID); exists {
+		session = synced
+	}
+
+	if err := ns.historyStore.Archive(session); err != nil {
+		log.Printf("Error archiving session %s: %v", session.ID, err)
+	} else if err := ns.stateStore.ForgetLottery(session.ID); err != nil {
+		log.Printf("Error forgetting lottery result for %s: %v", session.ID, err)
+	}
+
+	if ns.config.ArchiveToSheets {
+		if err := ns.sheetsService.ArchiveSession(session); err != nil {
+			log.Printf("Error archiving session %s to Google Sheets: %v", session.ID, err)
+		}
+	}
+
+	if session.Subject.Capacity > 0 {
+		if err := ns.sheetsService.WriteWaitlist(subjectName, nil); err != nil {
+			log.Printf("Error clearing waitlist for %s: %v", subjectName, err)
+		}
+	}
 
 	if err := ns.sheetsService.ClearColumn(subjectName); err != nil {
 		log.Printf("Error clearing Google Sheets column for %s: %v", subjectName, err)
 	} else {
-		log.Printf("Cleared queue and Google Sheets column for subject: %s", subjectName)
+		log.Printf("Finished session %s and cleared Google Sheets column for subject: %s", session.ID, subjectName)
+		if err := ns.stateStore.ForgetActiveSession(session.ID); err != nil {
+			log.Printf("Error forgetting session %s: %v", session.ID, err)
+		}
 	}
+
+	// From here on the session lives only in the history.
+	ns.queueManager.RemoveSession(session.ID)
 }
 
 func (ns *NotificationService) cleanupOldNotifications() {
-	now := time.Now()
-	cutoff := now.AddDate(0, 0, -1)
-
-	for key, sentTime := range ns.sentNotifications {
-		if sentTime.Before(cutoff) {
-			delete(ns.sentNotifications, key)
-		}
-	}
+	ns.state.forgetNotificationsBefore(time.Now().AddDate(0, 0, -1))
 }
 
 func (ns *NotificationService) cleanupStaleOperations() {
@@ -202,11 +318,10 @@ func (ns *NotificationService) cleanupStaleOperations() {
 	defer ns.operationsMutex.Unlock()
 
 	now := time.Now()
-	staleThreshold := 1 * time.Minute
 
 	var staleOperations []string
 	for operationKey, startTime := range ns.activeOperations {
-		if now.Sub(startTime) > staleThreshold {
+		if now.Sub(startTime) > ns.config.StaleOperationTimeout {
 			staleOperations = append(staleOperations, operationKey)
 		}
 	}
@@ -225,50 +340,67 @@ func (ns *NotificationService) HandleCallbackQuery(callbackQuery *tgbotapi.Callb
 	data := callbackQuery.Data
 
 	if strings.HasPrefix(data, "join_") {
-		shortCode := strings.TrimPrefix(data, "join_")
-		subjectName := ns.findSubjectByShortCode(shortCode)
-		if subjectName != "" {
-			ns.handleJoinQueue(callbackQuery, subjectName)
+		session, found := ns.resolveSession(strings.TrimPrefix(data, "join_"))
+		if found {
+			ns.handleJoinQueue(callbackQuery, session)
 		} else {
-			callback := tgbotapi.NewCallback(callbackQuery.ID, "❌ Предмет не найден")
-			ns.bot.Request(callback)
+			ns.answerCallback(callbackQuery.ID, ns.t("callback.subject_not_found", nil))
 		}
+	} else if strings.HasPrefix(data, "swapok_") || strings.HasPrefix(data, "swapno_") {
+		ns.handleSwapResponse(callbackQuery)
+	} else if strings.HasPrefix(data, "next_") || strings.HasPrefix(data, "skip_") {
+		ns.handleLiveQueueAction(callbackQuery)
 	} else if strings.HasPrefix(data, "leave_") {
-		shortCode := strings.TrimPrefix(data, "leave_")
-		subjectName := ns.findSubjectByShortCode(shortCode)
-		if subjectName != "" {
-			ns.handleLeaveQueue(callbackQuery, subjectName)
+		session, found := ns.resolveSession(strings.TrimPrefix(data, "leave_"))
+		if found {
+			ns.handleLeaveQueue(callbackQuery, session)
 		} else {
-			callback := tgbotapi.NewCallback(callbackQuery.ID, "❌ Предмет не найден")
-			ns.bot.Request(callback)
+			ns.answerCallback(callbackQuery.ID, ns.t("callback.subject_not_found", nil))
 		}
 	}
 }
 
+func (ns *NotificationService) resolveSession(key string) (Session, bool) {
+	if session, exists := ns.queueManager.GetSession(key); exists {
+		return session, true
+	}
+
+	subjectName := ns.findSubjectByShortCode(key)
+	if subjectName == "" {
+		return Session{}, false
+	}
+	return ns.queueManager.CurrentSession(subjectName)
+}
+
 func (ns *NotificationService) findSubjectByShortCode(shortCode string) string {
-	subjects := ns.queueManager.GetSubjects()
-	for _, subject := range subjects {
-		if mappedCode, exists := ns.queueManager.GetColumnMapping(subject.Name); exists && mappedCode == shortCode {
-			return subject.Name
-		}
+	return ns.queueManager.FindSubjectByShortCode(shortCode)
+}
+
+func (ns *NotificationService) handleJoinQueue(callbackQuery *tgbotapi.CallbackQuery, session Session) {
+	answer := func(text string) {
+		ns.answerCallback(callbackQuery.ID, text)
 	}
-	return ""
+	ns.joinQueue(callbackQuery.From, callbackQuery.Message.Chat.ID, session, "", answer)
 }
 
-func (ns *NotificationService) handleJoinQueue(callbackQuery *tgbotapi.CallbackQuery, subjectName string) {
-	user := callbackQuery.From
+func (ns *NotificationService) joinQueue(user *tgbotapi.User, chatID int64, session Session, note string, answer func(string)) {
+	subjectName := session.Subject.Name
+
+	if !session.AcceptsJoins() {
+		answer(ns.t("join.closed", nil))
+		return
+	}
 
-	operationKey := fmt.Sprintf("%d_%s", user.ID, subjectName)
+	operationKey := fmt.Sprintf("%d_%s", user.ID, session.ID)
 
 	ns.operationsMutex.Lock()
 	if startTime, exists := ns.activeOperations[operationKey]; exists {
 		ns.operationsMutex.Unlock()
 
-		if time.Since(startTime) > 30*time.Second {
+		if time.Since(startTime) > ns.config.StaleOperationTimeout {
 			log.Printf("Join operation %s seems stale, allowing new request", operationKey)
 		} else {
-			callback := tgbotapi.NewCallback(callbackQuery.ID, "⏳ Ваш запрос уже обрабатывается, подождите...")
-			ns.bot.Request(callback)
+			answer(ns.t("common.in_progress", nil))
 			return
 		}
 	}
@@ -284,19 +416,36 @@ func (ns *NotificationService) handleJoinQueue(callbackQuery *tgbotapi.CallbackQ
 
 	realName := ns.queueManager.GetUserRealName(user.UserName, user.FirstName, user.LastName)
 	if realName == "" {
-		callback := tgbotapi.NewCallback(callbackQuery.ID, "❌ Не удалось определить ваше реальное имя")
-		ns.bot.Request(callback)
+		answer(ns.t("common.unknown_user", nil))
 		return
 	}
+	ns.queueManager.RememberUserID(realName, user.ID)
 
-	if err := ns.syncQueueFromSheets(subjectName); err != nil {
+	// Reordering rewrites the whole column, so nobody else may touch it
+	// between the sync and the write.
+	unlock := ns.lockSheet(subjectName)
+
+	if err := ns.syncQueueFromSheets(session); err != nil {
 		log.Printf("Warning: Could not sync with Google Sheets: %v", err)
 	}
 
-	currentPosition := ns.queueManager.GetUserPositionInQueue(subjectName, realName)
-	if currentPosition > 0 {
-		callback := tgbotapi.NewCallback(callbackQuery.ID, fmt.Sprintf("✅ Вы уже в очереди! Место: %d", currentPosition))
-		ns.bot.Request(callback)
+	position, waitlisted, added := ns.queueManager.JoinOrWaitlist(session.ID, realName)
+	switch {
+	case !added && waitlisted:
+		unlock()
+		answer(ns.t("join.already_in_waitlist", vars{"Position": position}))
+		return
+	case !added:
+		unlock()
+		answer(ns.t("join.already_in_queue", vars{"Position": position}))
+		return
+	case waitlisted:
+		ns.writeWaitlistToSheets(session)
+		if note != "" {
+			ns.setNote(session, realName, note)
+		}
+		unlock()
+		ns.waitlistJoined(chatID, session, realName, position, answer)
 		return
 	}
 
@@ -304,100 +453,75 @@ func (ns *NotificationService) handleJoinQueue(callbackQuery *tgbotapi.CallbackQ
 
 	if err := ns.sheetsService.AddToSheet(subjectName, lastName); err != nil {
 		if strings.Contains(err.Error(), "already exists") {
-			if syncErr := ns.syncQueueFromSheets(subjectName); syncErr != nil {
+			if syncErr := ns.syncQueueFromSheets(session); syncErr != nil {
 				log.Printf("Error syncing after duplicate detection: %v", syncErr)
 			}
-			finalPosition := ns.queueManager.GetUserPositionInQueue(subjectName, realName)
+			finalPosition := ns.queueManager.GetUserPositionInQueue(session.ID, realName)
 			if finalPosition > 0 {
-				callback := tgbotapi.NewCallback(callbackQuery.ID, fmt.Sprintf("✅ Вы уже в очереди! Место: %d", finalPosition))
-				ns.bot.Request(callback)
+				unlock()
+				answer(ns.t("join.already_in_queue", vars{"Position": finalPosition}))
 				return
 			}
 		}
+		ns.queueManager.CancelJoin(session.ID, realName)
+		unlock()
 		log.Printf("Error adding to Google Sheets: %v", err)
-		callback := tgbotapi.NewCallback(callbackQuery.ID, "❌ Ошибка при записи в таблицу")
-		ns.bot.Request(callback)
+		answer(ns.t("join.sheet_error", nil))
 		return
 	}
 
-	if err := ns.syncQueueFromSheets(subjectName); err != nil {
+	if err := ns.syncQueueFromSheets(session); err != nil {
 		log.Printf("Error syncing after adding to sheets: %v", err)
 	}
 
-	finalPosition := ns.queueManager.GetUserPositionInQueue(subjectName, realName)
-	if finalPosition <= 0 {
-		position, wasAdded := ns.queueManager.JoinQueue(subjectName, realName)
-		if wasAdded {
-			finalPosition = position
-		} else {
-			finalPosition = ns.queueManager.GetUserPositionInQueue(subjectName, realName)
-		}
+	if ns.queueManager.GetUserPositionInQueue(session.ID, realName) <= 0 {
+		ns.queueManager.JoinQueue(session.ID, realName)
 	}
 
-	callback := tgbotapi.NewCallback(callbackQuery.ID, "✅ Вы записались в очередь!")
-	ns.bot.Request(callback)
-
-	chatMessage := fmt.Sprintf("✅ %s записался в очередь на \"%s\" (место: %d)", lastName, subjectName, finalPosition)
-
-	msg := tgbotapi.NewMessage(callbackQuery.Message.Chat.ID, chatMessage)
-	if _, err := ns.bot.Send(msg); err != nil {
-		log.Printf("Error sending chat message: %v", err)
+	if reordersOnJoin(session.Subject.Policy) {
+		ns.applyOrdering(session)
 	}
-
-	ns.updateOrCreateQueueMessage(callbackQuery.Message.Chat.ID, subjectName)
-
-	log.Printf("User %s joined queue for %s (position %d)", realName, subjectName, finalPosition)
-}
-
-func (ns *NotificationService) updateOrCreateQueueMessage(chatID int64, subjectName string) {
-	queue := ns.queueManager.GetQueue(subjectName)
-	var queueMessage string
-	if len(queue) == 0 {
-		queueMessage = fmt.Sprintf("📋 Текущая очередь на \"%s\":\n\n❌ Очередь пуста", subjectName)
-	} else {
-		queueMessage = fmt.Sprintf("📋 Текущая очередь на \"%s\":\n\n", subjectName)
-		for i, person := range queue {
-			personLastName := extractLastName(person)
-			queueMessage += fmt.Sprintf("%d. %s\n", i+1, personLastName)
-		}
+	finalPosition := ns.queueManager.GetUserPositionInQueue(session.ID, realName)
+	if note != "" {
+		ns.setNote(session, realName, note)
 	}
+	unlock()
 
-	if messageID, exists := ns.queueMessageIDs[subjectName]; exists {
-		editMsg := tgbotapi.NewEditMessageText(chatID, messageID, queueMessage)
-		if _, err := ns.bot.Send(editMsg); err != nil {
-			log.Printf("Error updating queue message: %v", err)
-
-			ns.createNewQueueMessage(chatID, subjectName, queueMessage)
-		}
+	if note != "" {
+		answer(ns.t("join.success", nil))
 	} else {
-		ns.createNewQueueMessage(chatID, subjectName, queueMessage)
+		answer(ns.t("join.success_note_hint", nil))
 	}
-}
 
-func (ns *NotificationService) createNewQueueMessage(chatID int64, subjectName string, queueMessage string) {
-	queueMsg := tgbotapi.NewMessage(chatID, queueMessage)
-	sentMsg, err := ns.bot.Send(queueMsg)
-	if err != nil {
-		log.Printf("Error sending queue message: %v", err)
-		return
+	announcement := "join.announce"
+	if session.Subject.Policy == PolicyLottery && session.LotteryDrawnAt.IsZero() {
+		announcement = "join.announce_lottery"
 	}
+	ns.announce(chatID, ns.t(announcement, vars{"Name": lastName, "Subject": subjectName, "Position": finalPosition}))
+
+	ns.updateOrCreateQueueMessage(chatID, session)
 
-	ns.queueMessageIDs[subjectName] = sentMsg.MessageID
+	log.Printf("User %s joined queue for %s (position %d)", realName, subjectName, finalPosition)
 }
 
-func (ns *NotificationService) handleLeaveQueue(callbackQuery *tgbotapi.CallbackQuery, subjectName string) {
+func (ns *NotificationService) handleLeaveQueue(callbackQuery *tgbotapi.CallbackQuery, session Session) {
 	user := callbackQuery.From
+	subjectName := session.Subject.Name
 
-	operationKey := fmt.Sprintf("leave_%d_%s", user.ID, subjectName)
+	if session.State == SessionFinished {
+		ns.answerCallback(callbackQuery.ID, ns.t("leave.finished", nil))
+		return
+	}
+
+	operationKey := fmt.Sprintf("leave_%d_%s", user.ID, session.ID)
 
 	ns.operationsMutex.Lock()
 	if startTime, exists := ns.activeOperations[operationKey]; exists {
 		ns.operationsMutex.Unlock()
-		if time.Since(startTime) > 30*time.Second {
+		if time.Since(startTime) > ns.config.StaleOperationTimeout {
 			log.Printf("Leave operation %s seems stale, allowing new request", operationKey)
 		} else {
-			callback := tgbotapi.NewCallback(callbackQuery.ID, "⏳ Ваш запрос уже обрабатывается, подождите...")
-			ns.bot.Request(callback)
+			ns.answerCallback(callbackQuery.ID, ns.t("common.in_progress", nil))
 			return
 		}
 	}
@@ -412,57 +536,79 @@ func (ns *NotificationService) handleLeaveQueue(callbackQuery *tgbotapi.Callback
 
 	realName := ns.queueManager.GetUserRealName(user.UserName, user.FirstName, user.LastName)
 	if realName == "" {
-		callback := tgbotapi.NewCallback(callbackQuery.ID, "❌ Не удалось определить ваше реальное имя")
-		ns.bot.Request(callback)
+		ns.answerCallback(callbackQuery.ID, ns.t("common.unknown_user", nil))
 		return
 	}
+	ns.queueManager.RememberUserID(realName, user.ID)
 
-	if err := ns.syncQueueFromSheets(subjectName); err != nil {
+	unlock := ns.lockSheet(subjectName)
+
+	if err := ns.syncQueueFromSheets(session); err != nil {
 		log.Printf("Warning: Could not sync with Google Sheets: %v", err)
 	}
 
-	currentPosition := ns.queueManager.GetUserPositionInQueue(subjectName, realName)
+	currentPosition := ns.queueManager.GetUserPositionInQueue(session.ID, realName)
+	if currentPosition <= 0 && ns.queueManager.GetWaitlistPosition(session.ID, realName) > 0 {
+		ns.queueManager.RemoveFromWaitlist(session.ID, realName)
+		ns.writeWaitlistToSheets(session)
+		unlock()
+		ns.waitlistLeft(callbackQuery, session, realName)
+		return
+	}
 	if currentPosition <= 0 {
-		callback := tgbotapi.NewCallback(callbackQuery.ID, "❌ Вы не записаны в очередь на этот предмет!")
-		ns.bot.Request(callback)
+		unlock()
+		ns.answerCallback(callbackQuery.ID, ns.t("leave.not_in_queue", nil))
 		return
 	}
 
-	ns.queueManager.RemoveFromQueue(subjectName, realName)
+	ns.queueManager.RemoveFromQueue(session.ID, realName)
 
 	lastName := extractLastName(realName)
 
 	if err := ns.sheetsService.RemoveFromSheet(subjectName, lastName); err != nil {
 		log.Printf("Error removing from Google Sheets: %v", err)
 
-		position, _ := ns.queueManager.JoinQueue(subjectName, realName)
-		callback := tgbotapi.NewCallback(callbackQuery.ID, "❌ Ошибка при удалении из таблицы")
-		ns.bot.Request(callback)
+		position, _ := ns.queueManager.JoinQueue(session.ID, realName)
+		unlock()
+		ns.answerCallback(callbackQuery.ID, ns.t("leave.sheet_error", nil))
 		log.Printf("Restored user %s to queue after Sheets error (position %d)", realName, position)
 		return
 	}
 
-	if err := ns.syncQueueFromSheets(subjectName); err != nil {
+	if err := ns.syncQueueFromSheets(session); err != nil {
 		log.Printf("Error syncing after removing from sheets: %v", err)
 	}
+	promoted := ns.promoteFromWaitlist(session)
+	unlock()
 
-	callback := tgbotapi.NewCallback(callbackQuery.ID, "✅ Вы вышли из очереди!")
-	ns.bot.Request(callback)
-
-	chatMessage := fmt.Sprintf("❌ %s вышел из очереди на \"%s\"", lastName, subjectName)
+	ns.answerCallback(callbackQuery.ID, ns.t("leave.success", nil))
 
-	msg := tgbotapi.NewMessage(callbackQuery.Message.Chat.ID, chatMessage)
-	if _, err := ns.bot.Send(msg); err != nil {
-		log.Printf("Error sending leave message: %v", err)
-	}
+	ns.announce(callbackQuery.Message.Chat.ID, ns.t("leave.announce", vars{"Name": lastName, "Subject": subjectName}))
 
-	ns.updateOrCreateQueueMessage(callbackQuery.Message.Chat.ID, subjectName)
+	ns.notifyPromoted(session, promoted)
+	ns.updateOrCreateQueueMessage(callbackQuery.Message.Chat.ID, session)
+	ns.remindApproachingTurns(session.ID)
 
 	log.Printf("User %s left queue for %s", realName, subjectName)
 }
 
-func (ns *NotificationService) syncQueueFromSheets(subjectName string) error {
-	queueFromSheets, err := ns.sheetsService.GetQueueFromSheet(subjectName)
+// lockSheet serializes the read-modify-write sequences on a subject's sheet
+// column and returns the function that releases it.
+func (ns *NotificationService) lockSheet(subjectName string) func() {
+	ns.sheetLocksMutex.Lock()
+	lock, exists := ns.sheetLocks[subjectName]
+	if !exists {
+		lock = &sync.Mutex{}
+		ns.sheetLocks[subjectName] = lock
+	}
+	ns.sheetLocksMutex.Unlock()
+
+	lock.Lock()
+	return lock.Unlock
+}
+
+func (ns *NotificationService) syncQueueFromSheets(session Session) error {
+	queueFromSheets, err := ns.sheetsService.GetQueueFromSheet(session.Subject.Name)
 	if err != nil {
 		return fmt.Errorf("failed to get queue from sheets: %w", err)
 	}
@@ -477,7 +623,9 @@ func (ns *NotificationService) syncQueueFromSheets(subjectName string) error {
 		}
 	}
 
-	ns.queueManager.SyncWithSheets(subjectName, fullNamesQueue)
+	ns.queueManager.SyncWithSheets(session.ID, fullNamesQueue)
+	// The sheet may have been edited by hand past the capacity.
+	ns.enforceCapacity(session)
 	return nil
 }
 
@@ -497,6 +645,11 @@ func (ns *NotificationService) syncAllQueuesFromSheets() {
 	subjects := ns.queueManager.GetSubjects()
 
 	for _, subject := range subjects {
+		session, exists := ns.queueManager.CurrentSession(subject.Name)
+		if !exists {
+			continue
+		}
+
 		log.Printf("🔄 Синхронизация очереди для предмета: %s", subject.Name)
 
 		sheetsQueue, err := ns.sheetsService.GetQueueFromSheet(subject.Name)
@@ -515,7 +668,24 @@ func (ns *NotificationService) syncAllQueuesFromSheets() {
 			}
 		}
 
-		ns.queueManager.SyncQueueFromSheets(subject.Name, fullNameQueue)
+		ns.queueManager.SyncQueueFromSheets(session.ID, fullNameQueue)
+
+		if notes, err := ns.sheetsService.GetNotesFromSheet(subject.Name); err != nil {
+			log.Printf("⚠️  Ошибка при получении заметок для %s: %v", subject.Name, err)
+		} else {
+			for lastName, note := range notes {
+				if fullName := ns.findFullNameByLastName(lastName); fullName != "" {
+					ns.queueManager.SetNote(session.ID, fullName, note)
+				}
+			}
+		}
+
+		if subject.Capacity > 0 {
+			if err := ns.syncWaitlistFromSheets(session); err != nil {
+				log.Printf("⚠️  Ошибка при получении листа ожидания для %s: %v", subject.Name, err)
+			}
+			ns.enforceCapacity(session)
+		}
 
 		log.Printf("✅ Синхронизировано %d пользователей для предмета %s", len(fullNameQueue), subject.Name)
 	}
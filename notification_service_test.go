@@ -0,0 +1,732 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// These tests are meant to be run with -race: they hammer the service from
+// many goroutines the way concurrent button presses and the scheduler do.
+
+const testChatID = -100
+
+// fakeSheet keeps the spreadsheet in memory. A delay makes reads and
+// writes of the queue column take as long as round trips to the API.
+type fakeSheet struct {
+	delay     time.Duration
+	mu        sync.Mutex
+	queues    map[string][]string
+	waitlists map[string][]string
+	notes     map[string]map[string]string
+}
+
+func newFakeSheet() *fakeSheet {
+	return &fakeSheet{
+		queues:    make(map[string][]string),
+		waitlists: make(map[string][]string),
+		notes:     make(map[string]map[string]string),
+	}
+}
+
+func (fs *fakeSheet) AddToSheet(subjectName, userName string) error {
+	time.Sleep(fs.delay)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	for _, name := range fs.queues[subjectName] {
+		if name == userName {
+			return nil
+		}
+	}
+	fs.queues[subjectName] = append(fs.queues[subjectName], userName)
+	return nil
+}
+
+func (fs *fakeSheet) RemoveFromSheet(subjectName, userName string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	queue := fs.queues[subjectName][:0:0]
+	for _, name := range fs.queues[subjectName] {
+		if name != userName {
+			queue = append(queue, name)
+		}
+	}
+	fs.queues[subjectName] = queue
+	return nil
+}
+
+func (fs *fakeSheet) ClearColumn(subjectName string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	delete(fs.queues, subjectName)
+	delete(fs.notes, subjectName)
+	return nil
+}
+
+func (fs *fakeSheet) GetQueueFromSheet(subjectName string) ([]string, error) {
+	time.Sleep(fs.delay)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return append([]string(nil), fs.queues[subjectName]...), nil
+}
+
+func (fs *fakeSheet) WriteQueue(subjectName string, userNames, notes []string) error {
+	time.Sleep(fs.delay)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.queues[subjectName] = append([]string(nil), userNames...)
+	return nil
+}
+
+func (fs *fakeSheet) SwapInSheet(subjectName, firstName, secondName string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	queue := fs.queues[subjectName]
+	i, j := -1, -1
+	for k, name := range queue {
+		switch name {
+		case firstName:
+			i = k
+		case secondName:
+			j = k
+		}
+	}
+	if i < 0 || j < 0 {
+		return fmt.Errorf("%s or %s not in %s", firstName, secondName, subjectName)
+	}
+	queue[i], queue[j] = queue[j], queue[i]
+	return nil
+}
+
+func (fs *fakeSheet) GetWaitlistFromSheet(subjectName string) ([]string, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return append([]string(nil), fs.waitlists[subjectName]...), nil
+}
+
+func (fs *fakeSheet) WriteWaitlist(subjectName string, userNames []string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.waitlists[subjectName] = append([]string(nil), userNames...)
+	return nil
+}
+
+func (fs *fakeSheet) GetNotesFromSheet(subjectName string) (map[string]string, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	notes := make(map[string]string)
+	for name, note := range fs.notes[subjectName] {
+		notes[name] = note
+	}
+	return notes, nil
+}
+
+func (fs *fakeSheet) WriteNote(subjectName, userName, note string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.notes[subjectName] == nil {
+		fs.notes[subjectName] = make(map[string]string)
+	}
+	fs.notes[subjectName][userName] = note
+	return nil
+}
+
+func (fs *fakeSheet) ArchiveSession(session Session) error {
+	return nil
+}
+
+func (fs *fakeSheet) WriteTable(title string, header []string, rows [][]string) error {
+	return nil
+}
+
+// newFakeTelegram answers every Bot API call successfully and counts them
+// by method.
+func newFakeTelegram(t *testing.T) (*tgbotapi.BotAPI, *sync.Map) {
+	t.Helper()
+
+	var messageID int64
+	calls := &sync.Map{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		counter, _ := calls.LoadOrStore(method, new(int64))
+		atomic.AddInt64(counter.(*int64), 1)
+
+		switch method {
+		case "getMe":
+			fmt.Fprint(w, `{"ok":true,"result":{"id":1,"is_bot":true,"first_name":"bot","username":"queue_bot"}}`)
+		case "getChatMember":
+			fmt.Fprint(w, `{"ok":true,"result":{"status":"administrator","user":{"id":1,"is_bot":false,"first_name":"admin"}}}`)
+		case "answerCallbackQuery", "pinChatMessage", "unpinChatMessage":
+			fmt.Fprint(w, `{"ok":true,"result":true}`)
+		default:
+			id := atomic.AddInt64(&messageID, 1)
+			fmt.Fprintf(w, `{"ok":true,"result":{"message_id":%d,"chat":{"id":%d,"type":"supergroup"},"date":0}}`, id, testChatID)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	bot, err := tgbotapi.NewBotAPIWithAPIEndpoint("test", server.URL+"/bot%s/%s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bot, calls
+}
+
+func callCount(calls *sync.Map, method string) int64 {
+	counter, ok := calls.Load(method)
+	if !ok {
+		return 0
+	}
+	return atomic.LoadInt64(counter.(*int64))
+}
+
+const testSubject = "Сопровождение программных систем"
+
+// newTestService builds a service with one subject whose registration is
+// open and the given number of students in the user mapping.
+func newTestService(t *testing.T, students int, mode QueueMessageMode) (*NotificationService, *fakeSheet, *sync.Map) {
+	t.Helper()
+	return newTestServiceWithPolicy(t, students, mode, PolicyFIFO)
+}
+
+// newTestServiceWithPolicy is newTestService for a subject with the given
+// ordering policy. Students with odd numbers owe one lab each.
+func newTestServiceWithPolicy(t *testing.T, students int, mode QueueMessageMode, policy string) (*NotificationService, *fakeSheet, *sync.Map) {
+	t.Helper()
+	dir := t.TempDir()
+
+	// Two days ahead always falls inside a 72h registration window.
+	day := getLocalTime().AddDate(0, 0, 2).Weekday()
+	schedule := fmt.Sprintf("%s,10:00,%q,11:30,%s\n", weekdayAbbrevs[day], testSubject, policy)
+	subjectsFile := filepath.Join(dir, "queue_lessons.txt")
+	if err := os.WriteFile(subjectsFile, []byte(schedule), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var debts []StudentDebt
+	for i := 1; i < students; i += 2 {
+		debts = append(debts, StudentDebt{RealName: studentName(i), Debts: 1})
+	}
+	if err := saveJSONFile(filepath.Join(dir, "debts.json"), debts); err != nil {
+		t.Fatal(err)
+	}
+
+	config := defaultConfig()
+	config.QueueChatID = testChatID
+	config.SubjectsFile = subjectsFile
+	config.HistoryFile = filepath.Join(dir, "history.json")
+	config.SubscriptionsFile = filepath.Join(dir, "subscriptions.json")
+	config.ProgressFile = filepath.Join(dir, "progress.json")
+	config.LabsFile = filepath.Join(dir, "labs.json")
+	config.DebtsFile = filepath.Join(dir, "debts.json")
+	config.QueueMessagesFile = filepath.Join(dir, "queue_messages.json")
+	config.StateFile = filepath.Join(dir, "state.json")
+	config.RegistrationWindow = 72 * time.Hour
+	config.QueueMessageMode = mode
+	config.QueueEditDelay = time.Millisecond
+	config.SendRateGlobal = 1_000_000
+	config.SendRateChat = 1_000_000_000
+
+	queueManager := NewQueueManager()
+	if err := queueManager.LoadSubjects(subjectsFile); err != nil {
+		t.Fatal(err)
+	}
+	queueManager.mu.Lock()
+	for i := 0; i < students; i++ {
+		queueManager.userMapping[studentUsername(i)] = studentName(i)
+	}
+	queueManager.mu.Unlock()
+
+	historyStore, err := NewHistoryStore(config.HistoryFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subscriptionStore, err := NewSubscriptionStore(config.SubscriptionsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	debtSource, err := NewFileDebtSource(config.DebtsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	progressStore, err := NewProgressStore(config.LabsFile, config.ProgressFile, debtSource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	messageStore, err := NewMessageStore(config.QueueMessagesFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stateStore, err := NewStateStore(config.StateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages, err := LoadMessages(config.Language, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bot, calls := newFakeTelegram(t)
+	sheet := newFakeSheet()
+	ns := NewNotificationService(NewSender(bot, config), queueManager, sheet, historyStore, subscriptionStore, progressStore, messageStore, stateStore, messages, config)
+	return ns, sheet, calls
+}
+
+// restartService builds a new service over the files and sheet of ns, the
+// way the bot comes back after a restart.
+func restartService(t *testing.T, ns *NotificationService, sheet *fakeSheet) *NotificationService {
+	t.Helper()
+	config := ns.config
+
+	queueManager := NewQueueManager()
+	if err := queueManager.LoadSubjects(config.SubjectsFile); err != nil {
+		t.Fatal(err)
+	}
+	for username, realName := range ns.queueManager.GetUserMappings() {
+		queueManager.userMapping[username] = realName
+	}
+	historyStore, err := NewHistoryStore(config.HistoryFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	messageStore, err := NewMessageStore(config.QueueMessagesFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stateStore, err := NewStateStore(config.StateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewNotificationService(ns.bot, queueManager, sheet, historyStore, ns.subscriptionStore, ns.progressStore, messageStore, stateStore, ns.messages, config)
+}
+
+func studentUsername(i int) string {
+	return fmt.Sprintf("student%d", i)
+}
+
+func studentName(i int) string {
+	return fmt.Sprintf("Студент%02d Имя", i)
+}
+
+func openSession(t *testing.T, ns *NotificationService) Session {
+	t.Helper()
+	session, found := ns.queueManager.CurrentSession(testSubject)
+	if !found || session.State != SessionOpen {
+		t.Fatalf("expected an open session for %s, got %+v (found %v)", testSubject, session.State, found)
+	}
+	return session
+}
+
+func pressButton(ns *NotificationService, student int, data string) {
+	ns.HandleCallbackQuery(&tgbotapi.CallbackQuery{
+		ID:   fmt.Sprintf("cb-%d-%s", student, data),
+		From: &tgbotapi.User{ID: int64(1000 + student), UserName: studentUsername(student)},
+		Message: &tgbotapi.Message{
+			MessageID: 1,
+			Chat:      &tgbotapi.Chat{ID: testChatID},
+		},
+		Data: data,
+	})
+}
+
+// runScheduler ticks the scheduler and its cleanups until stop is closed.
+func runScheduler(ns *NotificationService, stop <-chan struct{}) *sync.WaitGroup {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			ns.tick()
+			ns.cleanupOldNotifications()
+			ns.cleanupStaleOperations()
+			ns.cleanupExpiredSwapRequests()
+		}
+	}()
+	return &wg
+}
+
+// waitForQueueMessage lets the debounced queue message edits run.
+func waitForQueueMessage(ns *NotificationService) {
+	time.Sleep(20 * ns.config.QueueEditDelay)
+	ns.queueMessageMutex.Lock()
+	ns.queueMessageMutex.Unlock()
+}
+
+func TestConcurrentJoinsLeavesAndTicks(t *testing.T) {
+	for _, mode := range []QueueMessageMode{QueueMessageSeparate, QueueMessageInline} {
+		t.Run(string(mode), func(t *testing.T) {
+			const students = 30
+			ns, sheet, calls := newTestService(t, students, mode)
+			session := openSession(t, ns)
+
+			stop := make(chan struct{})
+			scheduler := runScheduler(ns, stop)
+
+			// Even students join and stay, odd ones join, leave and
+			// press "leave" once more.
+			var wg sync.WaitGroup
+			for i := 0; i < students; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					pressButton(ns, i, "join_"+session.ID)
+					pressButton(ns, i, "join_"+session.ID)
+					if i%2 == 1 {
+						pressButton(ns, i, "leave_"+session.ID)
+						pressButton(ns, i, "leave_"+session.ID)
+					}
+				}(i)
+			}
+			wg.Wait()
+			close(stop)
+			scheduler.Wait()
+			waitForQueueMessage(ns)
+
+			var want []string
+			for i := 0; i < students; i += 2 {
+				want = append(want, studentName(i))
+			}
+
+			got := ns.queueManager.GetQueue(session.ID)
+			sort.Strings(got)
+			if strings.Join(got, ",") != strings.Join(want, ",") {
+				t.Errorf("queue = %v, want %v", got, want)
+			}
+
+			inSheet, _ := sheet.GetQueueFromSheet(testSubject)
+			if len(inSheet) != len(want) {
+				t.Errorf("sheet has %d students, want %d: %v", len(inSheet), len(want), inSheet)
+			}
+
+			if _, tracked := ns.messageStore.Get(testChatID, session.ID, MessageQueue); !tracked {
+				t.Error("queue message is not tracked")
+			}
+			if n := callCount(calls, "answerCallbackQuery"); n != students*2+students/2*2 {
+				t.Errorf("answered %d callbacks, want %d", n, students*2+students/2*2)
+			}
+		})
+	}
+}
+
+// Policies that reorder on join rewrite the whole column; concurrent joins
+// must not erase each other from the sheet.
+func TestConcurrentJoinsWithReorderingPolicy(t *testing.T) {
+	const students = 30
+	ns, sheet, _ := newTestServiceWithPolicy(t, students, QueueMessageSeparate, PolicyDebt)
+	session := openSession(t, ns)
+	sheet.delay = time.Millisecond
+
+	var wg sync.WaitGroup
+	for i := 0; i < students; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			pressButton(ns, i, "join_"+session.ID)
+		}(i)
+	}
+	wg.Wait()
+
+	// A later sync must not drop anyone as departed.
+	if err := ns.syncQueueFromSheets(session); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := ns.queueManager.GetQueue(session.ID); len(got) != students {
+		t.Errorf("queue has %d students, want %d: %v", len(got), students, got)
+	}
+	inSheet, _ := sheet.GetQueueFromSheet(testSubject)
+	if len(inSheet) != students {
+		t.Errorf("sheet has %d students, want %d: %v", len(inSheet), students, inSheet)
+	}
+
+	// Debtors go first.
+	queue := ns.queueManager.GetQueue(session.ID)
+	for i, name := range queue {
+		debtor := ns.progressStore.Debts(testSubject, name) > 0
+		if debtor != (i < students/2) {
+			t.Errorf("position %d is %s (debtor %v), want debtors first: %v", i+1, name, debtor, queue)
+			break
+		}
+	}
+}
+
+func TestConcurrentJoinsRespectCapacity(t *testing.T) {
+	const students, capacity = 20, 5
+	ns, sheet, _ := newTestService(t, students, QueueMessageSeparate)
+	session := openSession(t, ns)
+	ns.queueManager.mu.Lock()
+	ns.queueManager.sessions[session.ID].Subject.Capacity = capacity
+	ns.queueManager.mu.Unlock()
+	session, _ = ns.queueManager.GetSession(session.ID)
+	sheet.delay = time.Millisecond
+
+	var wg sync.WaitGroup
+	for i := 0; i < students; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			pressButton(ns, i, "join_"+session.ID)
+		}(i)
+	}
+	wg.Wait()
+
+	if got := len(ns.queueManager.GetQueue(session.ID)); got != capacity {
+		t.Errorf("queue has %d students, want %d", got, capacity)
+	}
+	if got := len(ns.queueManager.GetWaitlist(session.ID)); got != students-capacity {
+		t.Errorf("waitlist has %d students, want %d", got, students-capacity)
+	}
+
+	// Someone adds two more rows to the sheet by hand.
+	inSheet, _ := sheet.GetQueueFromSheet(testSubject)
+	waitlist, _ := sheet.GetWaitlistFromSheet(testSubject)
+	if err := sheet.WriteQueue(testSubject, append(inSheet, waitlist[:2]...), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := ns.syncQueueFromSheets(session); err != nil {
+		t.Fatal(err)
+	}
+
+	inSheet, _ = sheet.GetQueueFromSheet(testSubject)
+	if len(inSheet) != capacity {
+		t.Errorf("sheet queue has %d students after sync, want %d: %v", len(inSheet), capacity, inSheet)
+	}
+	waitlist = ns.queueManager.GetWaitlist(session.ID)
+	if len(waitlist) != students-capacity {
+		t.Errorf("waitlist has %d students after sync, want %d: %v", len(waitlist), students-capacity, waitlist)
+	}
+	waitForQueueMessage(ns)
+}
+
+func TestDoubleTapAcceptSwapsOnce(t *testing.T) {
+	ns, sheet, _ := newTestService(t, 2, QueueMessageSeparate)
+	session := openSession(t, ns)
+	pressButton(ns, 0, "join_"+session.ID)
+	pressButton(ns, 1, "join_"+session.ID)
+
+	ns.swapMutex.Lock()
+	ns.swapRequests["1"] = SwapRequest{ID: "1", SessionID: session.ID, From: studentName(0), To: studentName(1), CreatedAt: time.Now()}
+	ns.swapMutex.Unlock()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pressButton(ns, 1, "swapok_1")
+		}()
+	}
+	wg.Wait()
+
+	want := []string{studentName(1), studentName(0)}
+	if got := ns.queueManager.GetQueue(session.ID); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("queue = %v, want %v", got, want)
+	}
+	inSheet, _ := sheet.GetQueueFromSheet(testSubject)
+	if len(inSheet) != 2 || inSheet[0] != extractLastName(studentName(1)) {
+		t.Errorf("sheet = %v, want the swapped order", inSheet)
+	}
+	waitForQueueMessage(ns)
+}
+
+func TestQueueMessagePostedOnce(t *testing.T) {
+	ns, _, calls := newTestService(t, 1, QueueMessageSeparate)
+	session := openSession(t, ns)
+	before := callCount(calls, "sendMessage")
+
+	ns.config.QueueEditDelay = 0
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ns.updateOrCreateQueueMessage(testChatID, session)
+		}()
+	}
+	wg.Wait()
+
+	if sent := callCount(calls, "sendMessage") - before; sent != 1 {
+		t.Errorf("queue message posted %d times, want 1", sent)
+	}
+}
+
+func TestNotificationSentOnceUnderConcurrentTicks(t *testing.T) {
+	ns, _, calls := newTestService(t, 0, QueueMessageSeparate)
+	openSession(t, ns)
+	before := callCount(calls, "sendMessage")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ns.tick()
+		}()
+	}
+	wg.Wait()
+
+	if sent := callCount(calls, "sendMessage") - before; sent != 0 {
+		t.Errorf("registration notification re-sent %d times by ticks", sent)
+	}
+}
+
+func TestServiceStateClaimsAreExclusive(t *testing.T) {
+	state := newServiceState()
+
+	var reminders int64
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if state.claimReminder("s1", 42) {
+				atomic.AddInt64(&reminders, 1)
+			}
+			state.recordNotification("s1", time.Now())
+			state.notificationSentAt("s1")
+			state.forgetNotificationsBefore(time.Now().Add(-time.Hour))
+		}()
+	}
+	wg.Wait()
+
+	if reminders != 1 {
+		t.Errorf("reminder claimed %d times, want 1", reminders)
+	}
+	state.forgetReminders("s1")
+	if !state.claimReminder("s1", 42) {
+		t.Error("reminder not claimable after forgetReminders")
+	}
+}
+
+func TestMessageStoreConcurrentAccess(t *testing.T) {
+	store, err := NewMessageStore(filepath.Join(t.TempDir(), "queue_messages.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sessionID := fmt.Sprintf("S-%d", i%4)
+			message := TrackedMessage{ChatID: testChatID, SessionID: sessionID, Kind: MessageQueue, MessageID: i}
+			if err := store.Set(message); err != nil {
+				t.Error(err)
+			}
+			store.Get(testChatID, sessionID, MessageQueue)
+			store.ForSession(sessionID)
+			if i%3 == 0 {
+				if _, _, err := store.Delete(testChatID, sessionID, MessageQueue); err != nil {
+					t.Error(err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	reloaded, err := NewMessageStore(store.filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		sessionID := fmt.Sprintf("S-%d", i)
+		_, inMemory := store.Get(testChatID, sessionID, MessageQueue)
+		_, onDisk := reloaded.Get(testChatID, sessionID, MessageQueue)
+		if inMemory != onDisk {
+			t.Errorf("%s: tracked in memory %v, on disk %v", sessionID, inMemory, onDisk)
+		}
+	}
+}
+
+func TestFinishedSessionIsDropped(t *testing.T) {
+	ns, _, _ := newTestService(t, 1, QueueMessageSeparate)
+	subject := openSession(t, ns).Subject
+
+	start := getLocalTime().Add(-2 * time.Hour).Truncate(time.Minute)
+	finished := ns.queueManager.EnsureSession(subject, start, start.Add(90*time.Minute), start.Add(-time.Hour), start)
+	ns.advanceSessions()
+	ns.advanceSessions()
+
+	if _, exists := ns.queueManager.GetSession(finished.ID); exists {
+		t.Error("finished session is still kept in memory")
+	}
+	if archived := ns.historyStore.GetSessions(testSubject); len(archived) != 1 || archived[0].ID != finished.ID {
+		t.Errorf("archived %d sessions, want only %s", len(archived), finished.ID)
+	}
+	// The upcoming class is left alone.
+	openSession(t, ns)
+}
+
+func TestClassEndedWhileDownIsArchived(t *testing.T) {
+	ns, sheet, _ := newTestService(t, 1, QueueMessageSeparate)
+	session := openSession(t, ns)
+	pressButton(ns, 0, "join_"+session.ID)
+
+	// Pretend the class took place while the bot was down.
+	past := session
+	past.Start = getLocalTime().Add(-3 * time.Hour).Truncate(time.Minute)
+	past.End = past.Start.Add(90 * time.Minute)
+	past.ID = newSessionID(ns.queueManager.sessionCode(testSubject), past.Start)
+	if err := ns.stateStore.ForgetActiveSession(session.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := ns.stateStore.SaveActiveSession(past); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted := restartService(t, ns, sheet)
+
+	archived := restarted.historyStore.GetSessions(testSubject)
+	if len(archived) != 1 || archived[0].ID != past.ID || len(archived[0].Queue) != 1 {
+		t.Fatalf("archived %+v, want %s with one student", archived, past.ID)
+	}
+	if queue, _ := sheet.GetQueueFromSheet(testSubject); len(queue) != 0 {
+		t.Errorf("sheet column not cleared: %v", queue)
+	}
+	if upcoming := openSession(t, restarted); len(upcoming.Queue) != 0 {
+		t.Errorf("next class took over the old queue: %v", upcoming.Names())
+	}
+	for _, active := range restarted.stateStore.ActiveSessions() {
+		if active.ID == past.ID {
+			t.Error("finished session is still recorded as active")
+		}
+	}
+}
+
+func TestRestartKeepsQueueNotification(t *testing.T) {
+	for _, mode := range []QueueMessageMode{QueueMessageSeparate, QueueMessageInline} {
+		t.Run(string(mode), func(t *testing.T) {
+			ns, sheet, calls := newTestService(t, 1, mode)
+			session := openSession(t, ns)
+			pressButton(ns, 0, "join_"+session.ID)
+			waitForQueueMessage(ns)
+
+			sent, edits := callCount(calls, "sendMessage"), callCount(calls, "editMessageText")
+			restarted := restartService(t, ns, sheet)
+			openSession(t, restarted)
+
+			if got := callCount(calls, "sendMessage"); got != sent {
+				t.Errorf("%d messages posted after the restart, want none", got-sent)
+			}
+			if callCount(calls, "editMessageText") == edits {
+				t.Error("tracked notification was not updated after the restart")
+			}
+		})
+	}
+}
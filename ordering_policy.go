@@ -0,0 +1,226 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"sort"
+)
+
+const (
+	PolicyFIFO     = "fifo"
+	PolicyRotation = "rotation"
+	PolicyLottery  = "lottery"
+	PolicyDebt     = "debt"
+)
+
+// OrderingPolicy decides the order of students who are still waiting.
+type OrderingPolicy interface {
+	Order(entries []QueueEntry) []QueueEntry
+}
+
+func isKnownPolicy(name string) bool {
+	switch name {
+	case PolicyFIFO, PolicyRotation, PolicyLottery, PolicyDebt:
+		return true
+	default:
+		return false
+	}
+}
+
+// reordersOnJoin reports whether the policy is re-applied after every join
+// rather than once at a fixed moment.
+func reordersOnJoin(name string) bool {
+	return name == PolicyRotation || name == PolicyDebt
+}
+
+type fifoPolicy struct{}
+
+func (fifoPolicy) Order(entries []QueueEntry) []QueueEntry {
+	return entries
+}
+
+type rotationPolicy struct {
+	missedLastTime map[string]bool
+}
+
+func (p rotationPolicy) Order(entries []QueueEntry) []QueueEntry {
+	result := make([]QueueEntry, len(entries))
+	copy(result, entries)
+	sort.SliceStable(result, func(i, j int) bool {
+		return p.missedLastTime[result[i].Name] && !p.missedLastTime[result[j].Name]
+	})
+	return result
+}
+
+// rotationAssumedServed is how many students are taken to have presented
+// at a class that was run without the live queue.
+const rotationAssumedServed = 10
+
+// missedLastTime lists the students of a finished class who did not get to
+// present: those skipped and those after the last one who presented.
+func missedLastTime(queue []QueueEntry) map[string]bool {
+	reached, live := -1, false
+	for i, entry := range queue {
+		switch entry.Status {
+		case EntryPresented:
+			reached, live = i, true
+		case EntryCalled, EntrySkipped:
+			live = true
+		}
+	}
+	if !live {
+		reached = rotationAssumedServed - 1
+	}
+
+	missed := make(map[string]bool)
+	for i, entry := range queue {
+		if entry.Status == EntrySkipped || (i > reached && entry.Status != EntryPresented) {
+			missed[entry.Name] = true
+		}
+	}
+	return missed
+}
+
+type debtPolicy struct {
+	subjectName string
+	debts       DebtSource
+}
+
+func (p debtPolicy) Order(entries []QueueEntry) []QueueEntry {
+	result := make([]QueueEntry, len(entries))
+	copy(result, entries)
+	sort.SliceStable(result, func(i, j int) bool {
+		return p.debts.Debts(p.subjectName, result[i].Name) > p.debts.Debts(p.subjectName, result[j].Name)
+	})
+	return result
+}
+
+// lotteryPolicy sorts sign-ups by name and shuffles them with a PRNG seeded
+// by seed, so anyone can reproduce the draw from the published seed.
+type lotteryPolicy struct {
+	seed int64
+}
+
+func (p lotteryPolicy) Order(entries []QueueEntry) []QueueEntry {
+	result := make([]QueueEntry, len(entries))
+	copy(result, entries)
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	rng := rand.New(rand.NewSource(p.seed))
+	rng.Shuffle(len(result), func(i, j int) {
+		result[i], result[j] = result[j], result[i]
+	})
+	return result
+}
+
+// drawnOrderPolicy keeps the order of a lottery that has already been drawn.
+// Students missing from it stay after everyone who took part.
+type drawnOrderPolicy struct {
+	order []string
+}
+
+func (p drawnOrderPolicy) Order(entries []QueueEntry) []QueueEntry {
+	rank := make(map[string]int, len(p.order))
+	for i, name := range p.order {
+		rank[name] = i
+	}
+	position := func(name string) int {
+		if i, exists := rank[name]; exists {
+			return i
+		}
+		return len(p.order)
+	}
+
+	result := make([]QueueEntry, len(entries))
+	copy(result, entries)
+	sort.SliceStable(result, func(i, j int) bool {
+		return position(result[i].Name) < position(result[j].Name)
+	})
+	return result
+}
+
+type DebtSource interface {
+	Debts(subjectName, realName string) int
+}
+
+type FileDebtSource struct {
+	debts map[string]int
+}
+
+func NewFileDebtSource(filename string) (*FileDebtSource, error) {
+	ds := &FileDebtSource{debts: make(map[string]int)}
+
+	var debts []StudentDebt
+	if err := loadJSONFile(filename, &debts); err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("error loading debts from %s: %w", filename, err)
+		}
+		log.Printf("Debts file %s not found, all debts are zero", filename)
+	}
+
+	for _, debt := range debts {
+		ds.debts[debt.RealName] = debt.Debts
+	}
+
+	log.Printf("Loaded debts for %d students", len(ds.debts))
+	return ds, nil
+}
+
+func (ds *FileDebtSource) Debts(subjectName, realName string) int {
+	return ds.debts[realName]
+}
+
+func (ns *NotificationService) orderingPolicy(session Session) OrderingPolicy {
+	switch session.Subject.Policy {
+	case PolicyRotation:
+		missed := make(map[string]bool)
+		if archived := ns.historyStore.GetSessions(session.Subject.Name); len(archived) > 0 {
+			missed = missedLastTime(archived[len(archived)-1].Queue)
+		}
+		return rotationPolicy{missedLastTime: missed}
+	case PolicyDebt:
+		return debtPolicy{subjectName: session.Subject.Name, debts: ns.progressStore}
+	case PolicyLottery:
+		if result, drawn := ns.stateStore.Lottery(session.ID); drawn {
+			return drawnOrderPolicy{order: append(result.Queue, result.Waitlist...)}
+		}
+		return lotteryPolicy{seed: session.LotterySeed}
+	default:
+		return fifoPolicy{}
+	}
+}
+
+func (ns *NotificationService) applyOrdering(session Session) {
+	changed, err := ns.queueManager.ReorderQueue(session.ID, ns.orderingPolicy(session))
+	if err != nil {
+		log.Printf("Error reordering queue %s: %v", session.ID, err)
+		return
+	}
+	if !changed {
+		return
+	}
+
+	ns.writeQueueToSheets(session)
+	log.Printf("🔀 Очередь %s переупорядочена по правилу %s", session.ID, session.Subject.Policy)
+}
+
+func (ns *NotificationService) writeQueueToSheets(session Session) {
+	current, exists := ns.queueManager.GetSession(session.ID)
+	if !exists {
+		return
+	}
+
+	names := current.Names()
+	lastNames := make([]string, len(names))
+	for i, name := range names {
+		lastNames[i] = extractLastName(name)
+	}
+
+	if err := ns.sheetsService.WriteQueue(session.Subject.Name, lastNames, current.Notes()); err != nil {
+		log.Printf("Error writing queue %s to Google Sheets: %v", session.ID, err)
+	}
+}
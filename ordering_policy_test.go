@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestMissedLastTime(t *testing.T) {
+	queue := func(statuses ...EntryStatus) []QueueEntry {
+		entries := make([]QueueEntry, len(statuses))
+		for i, status := range statuses {
+			entries[i] = QueueEntry{Name: fmt.Sprintf("s%02d", i+1), Status: status}
+		}
+		return entries
+	}
+	waiting := func(n int) []EntryStatus {
+		return make([]EntryStatus, n)
+	}
+
+	tests := []struct {
+		name  string
+		queue []QueueEntry
+		want  string
+	}{
+		{"everyone presented", queue(EntryPresented, EntryPresented), ""},
+		{"after the last presented", queue(EntryPresented, EntryPresented, EntryWaiting, EntryCalled), "s03 s04"},
+		{"skipped before the last presented", queue(EntryPresented, EntrySkipped, EntryPresented, EntryWaiting), "s02 s04"},
+		{"no live data, short queue", queue(waiting(5)...), ""},
+		{"no live data, long queue", queue(waiting(rotationAssumedServed + 2)...), "s11 s12"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var names []string
+			for name := range missedLastTime(tt.queue) {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			if got := strings.Join(names, " "); got != tt.want {
+				t.Errorf("missed %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
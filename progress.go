@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func (ns *NotificationService) handleLabStatusCommand(message *tgbotapi.Message, done bool) {
+	if !ns.isAdmin(ns.config.QueueChatID, message.From.ID) {
+		ns.reply(message, ns.t("progress.admin_only", nil))
+		return
+	}
+
+	args := strings.Fields(message.CommandArguments())
+	if len(args) < 2 {
+		ns.reply(message, ns.t("progress.mark_usage", vars{"Command": message.Command()}))
+		return
+	}
+
+	subjectName := ns.findSubjectByShortCode(args[0])
+	if subjectName == "" {
+		ns.reply(message, ns.t("common.subject_not_found", vars{"Code": args[0]}))
+		return
+	}
+	if len(ns.progressStore.Labs(subjectName)) == 0 {
+		ns.reply(message, ns.t("progress.no_labs", vars{"Subject": subjectName}))
+		return
+	}
+
+	realName := ns.findFullNameByLastName(args[1])
+	if realName == "" {
+		ns.reply(message, ns.t("progress.student_not_found", vars{"Name": args[1]}))
+		return
+	}
+
+	labsInput := strings.Join(args[2:], " ")
+	if labsInput == "" {
+		if session, exists := ns.queueManager.CurrentSession(subjectName); exists {
+			if i := session.position(realName); i >= 0 {
+				labsInput = session.Queue[i].Note
+			}
+		}
+	}
+
+	labs, unknown := ns.progressStore.MatchLabs(subjectName, labsInput)
+	if len(unknown) > 0 {
+		ns.reply(message, ns.t("progress.unknown_labs", vars{"Unknown": unknown, "Labs": ns.progressStore.Labs(subjectName)}))
+		return
+	}
+	if len(labs) == 0 {
+		ns.reply(message, ns.t("progress.no_labs_given", nil))
+		return
+	}
+
+	if err := ns.progressStore.SetStatus(subjectName, realName, labs, done, message.From.UserName); err != nil {
+		log.Printf("Error saving lab progress: %v", err)
+		ns.reply(message, ns.t("progress.save_error", nil))
+		return
+	}
+
+	status := "сдано"
+	if !done {
+		status = "не сдано"
+	}
+	ns.reply(message, ns.t("progress.marked", vars{"Name": realName, "Subject": subjectName, "Labs": labs, "Done": done}))
+	log.Printf("Lab progress: %s %s %v -> %s (by %s)", realName, subjectName, labs, status, message.From.UserName)
+
+	ns.mirrorProgressToSheets()
+}
+
+func (ns *NotificationService) formatProgress(subjectName, realName string) string {
+	labs := ns.progressStore.Labs(subjectName)
+	status := ns.progressStore.GetStatus(subjectName, realName)
+
+	type labLine struct {
+		Name string
+		Done bool
+		Date string
+	}
+	lines := make([]labLine, len(labs))
+	for i, lab := range labs {
+		lines[i] = labLine{Name: lab}
+		if labStatus := status[lab]; labStatus.Done {
+			lines[i].Done = true
+			lines[i].Date = labStatus.Date.In(getLocation()).Format("02.01.2006")
+		}
+	}
+	return ns.t("progress.subject", vars{"Subject": subjectName, "Labs": lines})
+}
+
+func (ns *NotificationService) handleProgressCommand(message *tgbotapi.Message) {
+	user := message.From
+	realName := ns.queueManager.GetUserRealName(user.UserName, user.FirstName, user.LastName)
+	if realName == "" {
+		ns.reply(message, ns.t("common.unknown_user", nil))
+		return
+	}
+
+	subjects := ns.progressStore.Subjects()
+	if arg := strings.TrimSpace(message.CommandArguments()); arg != "" {
+		subjectName := ns.findSubjectByShortCode(arg)
+		if subjectName == "" {
+			ns.reply(message, ns.t("common.subject_not_found", vars{"Code": arg}))
+			return
+		}
+		subjects = []string{subjectName}
+	}
+
+	if len(subjects) == 0 {
+		ns.reply(message, ns.t("progress.no_lab_lists", nil))
+		return
+	}
+
+	text := ns.t("progress.header", vars{"Name": realName}) + "\n\n"
+	for _, subjectName := range subjects {
+		if len(ns.progressStore.Labs(subjectName)) == 0 {
+			continue
+		}
+		text += ns.formatProgress(subjectName, realName) + "\n"
+	}
+	ns.reply(message, strings.TrimSpace(text))
+}
+
+func (ns *NotificationService) mirrorProgressToSheets() {
+	subjects := ns.progressStore.Subjects()
+
+	header := []string{ns.plain("column.student", nil)}
+	for _, subjectName := range subjects {
+		code, exists := ns.queueManager.GetColumnMapping(subjectName)
+		if !exists {
+			code = subjectName
+		}
+		for _, lab := range ns.progressStore.Labs(subjectName) {
+			header = append(header, fmt.Sprintf("%s %s", code, lab))
+		}
+	}
+
+	studentSet := make(map[string]bool)
+	for _, realName := range ns.queueManager.GetUserMappings() {
+		studentSet[realName] = true
+	}
+	for _, realName := range ns.progressStore.Students() {
+		studentSet[realName] = true
+	}
+	students := make([]string, 0, len(studentSet))
+	for realName := range studentSet {
+		students = append(students, realName)
+	}
+	sort.Strings(students)
+
+	rows := make([][]string, 0, len(students))
+	for _, realName := range students {
+		row := []string{realName}
+		for _, subjectName := range subjects {
+			status := ns.progressStore.GetStatus(subjectName, realName)
+			for _, lab := range ns.progressStore.Labs(subjectName) {
+				cell := ""
+				if labStatus := status[lab]; labStatus.Done {
+					cell = ns.plain("progress.sheet_done", vars{"Date": labStatus.Date.In(getLocation()).Format("02.01.2006")})
+				}
+				row = append(row, cell)
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	if err := ns.sheetsService.WriteTable(ns.plain("sheets.progress", nil), header, rows); err != nil {
+		log.Printf("Error mirroring lab progress to Google Sheets: %v", err)
+	}
+}
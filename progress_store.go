@@ -0,0 +1,182 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+type LabStatus struct {
+	Done      bool      `json:"done"`
+	Date      time.Time `json:"date,omitzero"`
+	UpdatedBy string    `json:"updated_by,omitempty"`
+}
+
+// ProgressStore keeps per-student lab submission status for the whole
+// semester. Subjects without a configured lab list fall back to the
+// wrapped debt source.
+type ProgressStore struct {
+	mu       sync.RWMutex
+	filename string
+	labs     map[string][]string
+	progress map[string]map[string]map[string]LabStatus
+	fallback DebtSource
+}
+
+func NewProgressStore(labsFile, progressFile string, fallback DebtSource) (*ProgressStore, error) {
+	ps := &ProgressStore{
+		filename: progressFile,
+		labs:     make(map[string][]string),
+		progress: make(map[string]map[string]map[string]LabStatus),
+		fallback: fallback,
+	}
+
+	if err := loadJSONFile(labsFile, &ps.labs); err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("error loading labs from %s: %w", labsFile, err)
+		}
+		log.Printf("Labs file %s not found, lab progress tracking is disabled", labsFile)
+	}
+
+	if err := loadJSONFile(progressFile, &ps.progress); err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("error loading progress from %s: %w", progressFile, err)
+		}
+	}
+
+	log.Printf("Loaded lab lists for %d subjects", len(ps.labs))
+	return ps, nil
+}
+
+func (ps *ProgressStore) Labs(subjectName string) []string {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
+	labs := make([]string, len(ps.labs[subjectName]))
+	copy(labs, ps.labs[subjectName])
+	return labs
+}
+
+func (ps *ProgressStore) Subjects() []string {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
+	subjects := make([]string, 0, len(ps.labs))
+	for subjectName := range ps.labs {
+		subjects = append(subjects, subjectName)
+	}
+	sort.Strings(subjects)
+	return subjects
+}
+
+// MatchLabs maps user input such as "ЛР3, лр4" or "3 4" to lab names
+// configured for the subject.
+func (ps *ProgressStore) MatchLabs(subjectName, input string) (matched []string, unknown []string) {
+	labs := ps.Labs(subjectName)
+	tokens := strings.FieldsFunc(input, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	for _, token := range tokens {
+		found := ""
+		for _, lab := range labs {
+			if strings.EqualFold(lab, token) || trailingDigits(lab) != "" && trailingDigits(lab) == token {
+				found = lab
+				break
+			}
+		}
+		if found != "" {
+			matched = append(matched, found)
+		} else {
+			unknown = append(unknown, token)
+		}
+	}
+	return matched, unknown
+}
+
+func trailingDigits(s string) string {
+	i := len(s)
+	for i > 0 && s[i-1] >= '0' && s[i-1] <= '9' {
+		i--
+	}
+	return s[i:]
+}
+
+func (ps *ProgressStore) SetStatus(subjectName, realName string, labs []string, done bool, updatedBy string) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if ps.progress[subjectName] == nil {
+		ps.progress[subjectName] = make(map[string]map[string]LabStatus)
+	}
+	if ps.progress[subjectName][realName] == nil {
+		ps.progress[subjectName][realName] = make(map[string]LabStatus)
+	}
+
+	for _, lab := range labs {
+		status := LabStatus{Done: done, UpdatedBy: updatedBy}
+		if done {
+			status.Date = time.Now()
+		}
+		ps.progress[subjectName][realName][lab] = status
+	}
+
+	if err := saveJSONFile(ps.filename, ps.progress); err != nil {
+		return fmt.Errorf("error saving progress to %s: %w", ps.filename, err)
+	}
+	return nil
+}
+
+func (ps *ProgressStore) GetStatus(subjectName, realName string) map[string]LabStatus {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
+	result := make(map[string]LabStatus)
+	for lab, status := range ps.progress[subjectName][realName] {
+		result[lab] = status
+	}
+	return result
+}
+
+func (ps *ProgressStore) Students() []string {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	var students []string
+	for _, bySubject := range ps.progress {
+		for realName := range bySubject {
+			if !seen[realName] {
+				seen[realName] = true
+				students = append(students, realName)
+			}
+		}
+	}
+	sort.Strings(students)
+	return students
+}
+
+func (ps *ProgressStore) Debts(subjectName, realName string) int {
+	labs := ps.Labs(subjectName)
+	if len(labs) == 0 {
+		if ps.fallback != nil {
+			return ps.fallback.Debts(subjectName, realName)
+		}
+		return 0
+	}
+
+	status := ps.GetStatus(subjectName, realName)
+	debts := 0
+	for _, lab := range labs {
+		if !status[lab].Done {
+			debts++
+		}
+	}
+	return debts
+}
@@ -1,11 +1,11 @@
 package main
 
 import (
-	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"log"
 	"os"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -13,17 +13,21 @@ import (
 
 type QueueManager struct {
 	mu            sync.RWMutex
-	subjectQueues map[string][]string
+	sessions      map[string]*Session
 	userMapping   map[string]string
+	userIDs       map[string]int64
 	subjects      []Subject
 	columnMapping map[string]string
+	overrides     map[string]map[string]ScheduleOverride
+	overridesFile string
 }
 
 func NewQueueManager() *QueueManager {
 	return &QueueManager{
-		subjectQueues: make(map[string][]string),
-		userMapping:   make(map[string]string),
-		subjects:      make([]Subject, 0),
+		sessions:    make(map[string]*Session),
+		userMapping: make(map[string]string),
+		userIDs:     make(map[string]int64),
+		subjects:    make([]Subject, 0),
 		columnMapping: map[string]string{
 			"Микросервисная архитектура":                             "Микросервисы",
 			"Стандартизация и сертификация программного обеспечения": "СИСПО",
@@ -43,35 +47,23 @@ func (qm *QueueManager) LoadSubjects(filename string) error {
 	}
 	defer file.Close()
 
-	reader := csv.NewReader(file)
-	records, err := reader.ReadAll()
+	subjects, err := parseSubjects(file, qm.knownSubject)
 	if err != nil {
-		return fmt.Errorf("error reading CSV: %w", err)
+		return fmt.Errorf("invalid schedule %s:\n%w", filename, err)
 	}
 
 	qm.mu.Lock()
-	defer qm.mu.Unlock()
+	qm.subjects = subjects
+	qm.mu.Unlock()
 
-	qm.subjects = make([]Subject, 0, len(records))
-	for _, record := range records {
-		if len(record) >= 4 {
-			qm.subjects = append(qm.subjects, Subject{
-				Day:   record[0],
-				Start: record[1],
-				Name:  record[2],
-				End:   record[3],
-			})
-		}
-	}
-
-	log.Printf("Loaded %d subjects", len(qm.subjects))
+	log.Printf("Loaded %d subjects", len(subjects))
 	return nil
 }
 
 func (qm *QueueManager) LoadUserMapping(filename string) error {
 	file, err := os.Open(filename)
 	if err != nil {
-		log.Println("Warning: user_mapping.json not found, creating empty mapping")
+		log.Printf("Warning: %s not found, creating empty mapping", filename)
 		return nil
 	}
 	defer file.Close()
@@ -99,6 +91,9 @@ func (qm *QueueManager) GetSubjects() []Subject {
 
 	subjects := make([]Subject, len(qm.subjects))
 	copy(subjects, qm.subjects)
+	for i := range subjects {
+		subjects[i].Overrides = qm.overrides[subjects[i].Name]
+	}
 	return subjects
 }
 
@@ -115,42 +110,254 @@ func (qm *QueueManager) GetUserRealName(username, firstName, lastName string) st
 	return ""
 }
 
-func (qm *QueueManager) JoinQueue(subjectName, realName string) (int, bool) {
+func (qm *QueueManager) sessionCode(subjectName string) string {
+	if code, exists := qm.columnMapping[subjectName]; exists {
+		return code
+	}
+	return subjectName
+}
+
+func (qm *QueueManager) EnsureSession(subject Subject, start, end, registrationOpens, registrationCloses time.Time) Session {
 	qm.mu.Lock()
 	defer qm.mu.Unlock()
 
-	queue := qm.subjectQueues[subjectName]
+	id := newSessionID(qm.sessionCode(subject.Name), start)
+	if session, exists := qm.sessions[id]; exists {
+		return session.clone()
+	}
+
+	session := &Session{
+		ID:       id,
+		Subject:  subject,
+		Start:    start,
+		End:      end,
+		OpensAt:  registrationOpens,
+		ClosesAt: registrationCloses,
+		State:    SessionScheduled,
+		Queue:    make([]QueueEntry, 0),
+	}
+	qm.sessions[id] = session
+	log.Printf("🗓️  Создана сессия %s (%s, %s)", id, subject.Name, start.Format("2006-01-02 15:04"))
+	return session.clone()
+}
 
-	for i, name := range queue {
-		if name == realName {
-			log.Printf("⚠️  Пользователь %s уже есть в очереди %s на позиции %d", realName, subjectName, i+1)
-			return i + 1, false
+func (qm *QueueManager) GetSession(sessionID string) (Session, bool) {
+	qm.mu.RLock()
+	defer qm.mu.RUnlock()
+
+	session, exists := qm.sessions[sessionID]
+	if !exists {
+		return Session{}, false
+	}
+	return session.clone(), true
+}
+
+func (qm *QueueManager) GetSessions() []Session {
+	qm.mu.RLock()
+	defer qm.mu.RUnlock()
+
+	result := make([]Session, 0, len(qm.sessions))
+	for _, session := range qm.sessions {
+		result = append(result, session.clone())
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Start.Before(result[j].Start)
+	})
+	return result
+}
+
+func (qm *QueueManager) CurrentSession(subjectName string) (Session, bool) {
+	qm.mu.RLock()
+	defer qm.mu.RUnlock()
+
+	var current *Session
+	for _, session := range qm.sessions {
+		if session.Subject.Name != subjectName || session.State == SessionFinished {
+			continue
+		}
+		if current == nil || session.Start.Before(current.Start) {
+			current = session
 		}
 	}
 
-	qm.subjectQueues[subjectName] = append(queue, realName)
-	log.Printf("✅ Пользователь %s добавлен в очередь %s на позицию %d", realName, subjectName, len(qm.subjectQueues[subjectName]))
-	return len(qm.subjectQueues[subjectName]), true
+	if current == nil {
+		return Session{}, false
+	}
+	return current.clone(), true
 }
 
-func (qm *QueueManager) RemoveFromQueue(subjectName, realName string) {
+func (qm *QueueManager) SetSessionState(sessionID string, state SessionState) error {
 	qm.mu.Lock()
 	defer qm.mu.Unlock()
 
-	queue := qm.subjectQueues[subjectName]
-	for i, name := range queue {
+	session, exists := qm.sessions[sessionID]
+	if !exists {
+		return fmt.Errorf("session not found: %s", sessionID)
+	}
+
+	if !session.State.CanTransitionTo(state) {
+		return fmt.Errorf("invalid session transition for %s: %s -> %s", sessionID, session.State, state)
+	}
+
+	log.Printf("🔀 Сессия %s: %s → %s", sessionID, session.State, state)
+	session.State = state
+	return nil
+}
+
+func (qm *QueueManager) GetUsernameByRealName(realName string) string {
+	qm.mu.RLock()
+	defer qm.mu.RUnlock()
+
+	for username, name := range qm.userMapping {
 		if name == realName {
-			qm.subjectQueues[subjectName] = append(queue[:i], queue[i+1:]...)
+			return username
+		}
+	}
+	return ""
+}
+
+func (qm *QueueManager) RememberUserID(realName string, userID int64) {
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+
+	qm.userIDs[realName] = userID
+}
+
+func (qm *QueueManager) GetUserID(realName string) (int64, bool) {
+	qm.mu.RLock()
+	defer qm.mu.RUnlock()
+
+	userID, exists := qm.userIDs[realName]
+	return userID, exists
+}
+
+// AdvanceQueue closes the turn of whoever is currently presenting with the
+// given status and calls the next waiting student. It returns the entry
+// that was closed (if any) and the entry that was called (if any).
+func (qm *QueueManager) AdvanceQueue(sessionID string, status EntryStatus) (closed *QueueEntry, called *QueueEntry, err error) {
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+
+	session, exists := qm.sessions[sessionID]
+	if !exists {
+		return nil, nil, fmt.Errorf("session not found: %s", sessionID)
+	}
+
+	if session.State != SessionInProgress {
+		return nil, nil, fmt.Errorf("session %s is not in progress", sessionID)
+	}
+
+	now := time.Now()
+	if i := session.current(); i >= 0 {
+		session.Queue[i].Status = status
+		session.Queue[i].FinishedAt = now
+		entry := session.Queue[i]
+		closed = &entry
+	}
+
+	if i := session.nextWaiting(); i >= 0 {
+		session.Queue[i].Status = EntryCalled
+		session.Queue[i].CalledAt = now
+		entry := session.Queue[i]
+		called = &entry
+	}
+
+	return closed, called, nil
+}
+
+// ReorderQueue reorders the students still waiting in line according to
+// the policy. Students who have already been called keep their places.
+func (qm *QueueManager) ReorderQueue(sessionID string, policy OrderingPolicy) (bool, error) {
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+
+	session, exists := qm.sessions[sessionID]
+	if !exists {
+		return false, fmt.Errorf("session not found: %s", sessionID)
+	}
+
+	var done, waiting []QueueEntry
+	for _, entry := range session.Queue {
+		if entry.Status == EntryWaiting {
+			waiting = append(waiting, entry)
+		} else {
+			done = append(done, entry)
+		}
+	}
+
+	queue := append(done, policy.Order(waiting)...)
+	changed := false
+	for i := range queue {
+		if queue[i].Name != session.Queue[i].Name {
+			changed = true
 			break
 		}
 	}
+
+	session.Queue = queue
+	return changed, nil
 }
 
-func (qm *QueueManager) ClearQueue(subjectName string) {
+func (qm *QueueManager) MarkLotteryDrawn(sessionID string, seed int64, drawnAt time.Time) {
 	qm.mu.Lock()
 	defer qm.mu.Unlock()
 
-	delete(qm.subjectQueues, subjectName)
+	if session, exists := qm.sessions[sessionID]; exists {
+		session.LotterySeed = seed
+		session.LotteryDrawnAt = drawnAt
+	}
+}
+
+func (qm *QueueManager) JoinQueue(sessionID, realName string) (int, bool) {
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+
+	session, exists := qm.sessions[sessionID]
+	if !exists {
+		log.Printf("⚠️  Сессия %s не найдена", sessionID)
+		return 0, false
+	}
+
+	if i := session.position(realName); i >= 0 {
+		log.Printf("⚠️  Пользователь %s уже есть в очереди %s на позиции %d", realName, sessionID, i+1)
+		return i + 1, false
+	}
+
+	session.Queue = append(session.Queue, QueueEntry{Name: realName, JoinedAt: time.Now()})
+	log.Printf("✅ Пользователь %s добавлен в очередь %s на позицию %d", realName, sessionID, len(session.Queue))
+	return len(session.Queue), true
+}
+
+func (qm *QueueManager) RemoveFromQueue(sessionID, realName string) {
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+
+	session, exists := qm.sessions[sessionID]
+	if !exists {
+		return
+	}
+
+	if i := session.position(realName); i >= 0 {
+		session.depart(i, time.Now())
+	}
+}
+
+func (qm *QueueManager) ClearQueue(sessionID string) {
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+
+	if session, exists := qm.sessions[sessionID]; exists {
+		session.Queue = make([]QueueEntry, 0)
+	}
+}
+
+func (qm *QueueManager) FindSubjectByShortCode(shortCode string) string {
+	for _, subject := range qm.GetSubjects() {
+		if mappedCode, exists := qm.GetColumnMapping(subject.Name); exists && mappedCode == shortCode {
+			return subject.Name
+		}
+	}
+	return ""
 }
 
 func (qm *QueueManager) GetColumnMapping(subjectName string) (string, bool) {
@@ -158,32 +365,41 @@ func (qm *QueueManager) GetColumnMapping(subjectName string) (string, bool) {
 	return columnName, exists
 }
 
-func (qm *QueueManager) GetQueueInfo(subjectName, realName string) (position int, previousUser string, found bool) {
+// GetQueueInfo returns the student's position among those who have not
+// presented yet and the name of the student directly ahead of them.
+func (qm *QueueManager) GetQueueInfo(sessionID, realName string) (position int, previousUser string, found bool) {
 	qm.mu.RLock()
 	defer qm.mu.RUnlock()
 
-	queue, exists := qm.subjectQueues[subjectName]
+	session, exists := qm.sessions[sessionID]
 	if !exists {
 		return 0, "", false
 	}
 
-	for i, name := range queue {
-		if name == realName {
-			position = i + 1
-			if i > 0 {
-				previousUser = queue[i-1]
-			}
+	for _, entry := range session.Queue {
+		if entry.Status != EntryWaiting && entry.Status != EntryCalled {
+			continue
+		}
+		position++
+		if entry.Name == realName {
 			return position, previousUser, true
 		}
+		previousUser = entry.Name
 	}
 
 	return 0, "", false
 }
 
 func GetNextSubjectTime(subject Subject) *time.Time {
+	if len(subject.Overrides) > 0 {
+		return nextEffectiveStart(subject, getLocalTime())
+	}
+	if len(subject.Occurrences) > 0 {
+		return nextOccurrence(subject, getLocalTime())
+	}
 
-	moscowTZ := getMoscowLocation()
-	now := getMoscowTime()
+	loc := getLocation()
+	now := getLocalTime()
 
 	startTime, err := time.Parse("15:04", subject.Start)
 	if err != nil {
@@ -199,8 +415,8 @@ func GetNextSubjectTime(subject Subject) *time.Time {
 
 	daysUntil := (int(targetWeekday) - int(now.Weekday()) + 7) % 7
 	if daysUntil == 0 {
-		currentTime := time.Date(now.Year(), now.Month(), now.Day(), now.Hour(), now.Minute(), 0, 0, moscowTZ)
-		subjectTime := time.Date(now.Year(), now.Month(), now.Day(), startTime.Hour(), startTime.Minute(), 0, 0, moscowTZ)
+		currentTime := time.Date(now.Year(), now.Month(), now.Day(), now.Hour(), now.Minute(), 0, 0, loc)
+		subjectTime := time.Date(now.Year(), now.Month(), now.Day(), startTime.Hour(), startTime.Minute(), 0, 0, loc)
 
 		if currentTime.After(subjectTime) {
 			daysUntil = 7
@@ -209,7 +425,7 @@ func GetNextSubjectTime(subject Subject) *time.Time {
 
 	nextDate := now.AddDate(0, 0, daysUntil)
 	nextSubjectTime := time.Date(nextDate.Year(), nextDate.Month(), nextDate.Day(),
-		startTime.Hour(), startTime.Minute(), 0, 0, moscowTZ)
+		startTime.Hour(), startTime.Minute(), 0, 0, loc)
 
 	return &nextSubjectTime
 }
@@ -220,36 +436,70 @@ func GetNextSubjectEndTime(subject Subject) *time.Time {
 		return nil
 	}
 
-	endTime, err := time.Parse("15:04", subject.End)
+	duration, err := subjectDuration(subject)
 	if err != nil {
-		log.Printf("Error parsing end time for %s: %v", subject.Name, err)
+		log.Printf("Error parsing class times for %s: %v", subject.Name, err)
 		return nil
 	}
 
-	nextEndTime := time.Date(startTime.Year(), startTime.Month(), startTime.Day(),
-		endTime.Hour(), endTime.Minute(), 0, 0, startTime.Location())
-
+	nextEndTime := startTime.Add(duration)
 	return &nextEndTime
 }
 
-func (qm *QueueManager) GetQueue(subjectName string) []string {
+func (qm *QueueManager) GetQueue(sessionID string) []string {
 	qm.mu.RLock()
 	defer qm.mu.RUnlock()
 
-	queue, exists := qm.subjectQueues[subjectName]
+	session, exists := qm.sessions[sessionID]
 	if !exists {
 		return []string{}
 	}
 
-	result := make([]string, len(queue))
-	copy(result, queue)
-	return result
+	return session.Names()
+}
+
+// replaceQueue swaps the queue contents while keeping the entries of
+// people who were already in line. Anyone missing from names is recorded
+// as departed.
+func (qm *QueueManager) replaceQueue(session *Session, names []string) {
+	now := time.Now()
+	keep := make(map[string]bool, len(names))
+	for _, name := range names {
+		keep[name] = true
+	}
+
+	for i := len(session.Queue) - 1; i >= 0; i-- {
+		if !keep[session.Queue[i].Name] {
+			session.depart(i, now)
+		}
+	}
+
+	existing := make(map[string]QueueEntry, len(session.Queue))
+	for _, entry := range session.Queue {
+		existing[entry.Name] = entry
+	}
+
+	queue := make([]QueueEntry, 0, len(names))
+	for _, name := range names {
+		entry, exists := existing[name]
+		if !exists {
+			entry = QueueEntry{Name: name, JoinedAt: now}
+		}
+		queue = append(queue, entry)
+	}
+	session.Queue = queue
 }
 
-func (qm *QueueManager) SyncWithSheets(subjectName string, queueFromSheets []string) {
+func (qm *QueueManager) SyncWithSheets(sessionID string, queueFromSheets []string) {
 	qm.mu.Lock()
 	defer qm.mu.Unlock()
 
+	session, exists := qm.sessions[sessionID]
+	if !exists {
+		log.Printf("⚠️  Сессия %s не найдена, синхронизация пропущена", sessionID)
+		return
+	}
+
 	var cleanQueue []string
 	seen := make(map[string]bool)
 	duplicatesCount := 0
@@ -259,7 +509,7 @@ func (qm *QueueManager) SyncWithSheets(subjectName string, queueFromSheets []str
 		if cleanName != "" {
 			if seen[cleanName] {
 				duplicatesCount++
-				log.Printf("⚠️  Обнаружен дубликат в Google Sheets: %s для предмета %s", cleanName, subjectName)
+				log.Printf("⚠️  Обнаружен дубликат в Google Sheets: %s для сессии %s", cleanName, sessionID)
 			} else {
 				cleanQueue = append(cleanQueue, cleanName)
 				seen[cleanName] = true
@@ -268,26 +518,24 @@ func (qm *QueueManager) SyncWithSheets(subjectName string, queueFromSheets []str
 	}
 
 	if duplicatesCount > 0 {
-		log.Printf("🔄 Синхронизация очереди для предмета '%s': %v (удалено дубликатов: %d)", subjectName, cleanQueue, duplicatesCount)
+		log.Printf("🔄 Синхронизация очереди для сессии '%s': %v (удалено дубликатов: %d)", sessionID, cleanQueue, duplicatesCount)
 	} else {
-		log.Printf("🔄 Синхронизация очереди для предмета '%s': %v", subjectName, cleanQueue)
+		log.Printf("🔄 Синхронизация очереди для сессии '%s': %v", sessionID, cleanQueue)
 	}
-	qm.subjectQueues[subjectName] = cleanQueue
+	qm.replaceQueue(session, cleanQueue)
 }
 
-func (qm *QueueManager) GetUserPositionInQueue(subjectName, realName string) int {
+func (qm *QueueManager) GetUserPositionInQueue(sessionID, realName string) int {
 	qm.mu.RLock()
 	defer qm.mu.RUnlock()
 
-	queue, exists := qm.subjectQueues[subjectName]
+	session, exists := qm.sessions[sessionID]
 	if !exists {
 		return -1
 	}
 
-	for i, name := range queue {
-		if name == realName {
-			return i + 1
-		}
+	if i := session.position(realName); i >= 0 {
+		return i + 1
 	}
 
 	return -1
@@ -304,12 +552,17 @@ func (qm *QueueManager) GetUserMappings() map[string]string {
 	return result
 }
 
-func (qm *QueueManager) SyncQueueFromSheets(subjectName string, queue []string) {
+func (qm *QueueManager) SyncQueueFromSheets(sessionID string, queue []string) {
 	qm.mu.Lock()
 	defer qm.mu.Unlock()
 
-	qm.subjectQueues[subjectName] = make([]string, len(queue))
-	copy(qm.subjectQueues[subjectName], queue)
+	session, exists := qm.sessions[sessionID]
+	if !exists {
+		log.Printf("⚠️  Сессия %s не найдена, синхронизация пропущена", sessionID)
+		return
+	}
+
+	qm.replaceQueue(session, queue)
 
-	log.Printf("🔄 Очередь для %s синхронизирована: %d пользователей", subjectName, len(queue))
+	log.Printf("🔄 Очередь для %s синхронизирована: %d пользователей", sessionID, len(queue))
 }
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// QueueMessageMode selects how the current queue is shown in the chat.
+type QueueMessageMode string
+
+const (
+	// QueueMessageSeparate posts the queue as its own message next to the
+	// registration notification.
+	QueueMessageSeparate QueueMessageMode = "separate"
+	// QueueMessageInline edits the registration notification itself so the
+	// queue is shown under its buttons.
+	QueueMessageInline QueueMessageMode = "inline"
+)
+
+func parseQueueMessageMode(value string) (QueueMessageMode, bool) {
+	switch mode := QueueMessageMode(strings.ToLower(value)); mode {
+	case QueueMessageSeparate, QueueMessageInline:
+		return mode, true
+	default:
+		return "", false
+	}
+}
+
+func (ns *NotificationService) joinKeyboard(sessionID string) tgbotapi.InlineKeyboardMarkup {
+	joinButton := tgbotapi.NewInlineKeyboardButtonData(ns.t("button.join", nil), fmt.Sprintf("join_%s", sessionID))
+	leaveButton := tgbotapi.NewInlineKeyboardButtonData(ns.t("button.leave", nil), fmt.Sprintf("leave_%s", sessionID))
+	return tgbotapi.NewInlineKeyboardMarkup([]tgbotapi.InlineKeyboardButton{joinButton, leaveButton})
+}
+
+func (ns *NotificationService) notificationText(session Session) string {
+	subject := session.Subject
+	lotteryAt := ""
+	if subject.Policy == PolicyLottery {
+		lotteryAt = session.RegistrationClosesAt().In(getLocation()).Format("02.01 15:04")
+	}
+	return ns.t("notification.open", vars{
+		"Subject":   subject.Name,
+		"Day":       ns.weekdayName(subject.Day),
+		"Start":     subject.Start,
+		"End":       subject.End,
+		"LotteryAt": lotteryAt,
+	})
+}
+
+// queueMessageText renders the message that tracks a session's queue. In
+// inline mode it is the registration notification followed by the queue.
+func (ns *NotificationService) queueMessageText(session Session) string {
+	queue := ns.t("queue.message", vars{
+		"Subject":  session.Subject.Name,
+		"Queue":    session.Queue,
+		"Waitlist": session.Waitlist,
+		"Capacity": session.Subject.Capacity,
+	})
+	if ns.config.QueueMessageMode != QueueMessageInline {
+		return queue
+	}
+	return ns.notificationText(session) + "\n\n" + queue
+}
+
+// announce posts a join/leave notice unless announcements are turned off.
+func (ns *NotificationService) announce(chatID int64, text string) {
+	if !ns.config.AnnounceJoins {
+		return
+	}
+	if _, err := ns.bot.Send(ns.newMessage(chatID, text)); err != nil {
+		log.Printf("Error sending chat message: %v", err)
+	}
+}
+
+// updateOrCreateQueueMessage schedules a refresh of the session's queue
+// message. Requests arriving within QueueEditDelay are merged into a single
+// edit so bursts of joins stay within Telegram's limits.
+func (ns *NotificationService) updateOrCreateQueueMessage(chatID int64, session Session) {
+	if ns.config.QueueEditDelay <= 0 {
+		ns.refreshQueueMessage(chatID, session.ID)
+		return
+	}
+
+	ns.queueUpdatesMutex.Lock()
+	defer ns.queueUpdatesMutex.Unlock()
+
+	if ns.queueUpdates[session.ID] {
+		return
+	}
+	ns.queueUpdates[session.ID] = true
+
+	time.AfterFunc(ns.config.QueueEditDelay, func() {
+		ns.queueUpdatesMutex.Lock()
+		delete(ns.queueUpdates, session.ID)
+		ns.queueUpdatesMutex.Unlock()
+
+		ns.refreshQueueMessage(chatID, session.ID)
+	})
+}
+
+func (ns *NotificationService) queueMessageKeyboard(session Session) *tgbotapi.InlineKeyboardMarkup {
+	if ns.config.QueueMessageMode != QueueMessageInline || !session.AcceptsJoins() {
+		return nil
+	}
+	keyboard := ns.joinKeyboard(session.ID)
+	return &keyboard
+}
+
+func (ns *NotificationService) refreshQueueMessage(chatID int64, sessionID string) {
+	// Serialized so that two refreshes never both find the message missing
+	// and post it twice.
+	ns.queueMessageMutex.Lock()
+	defer ns.queueMessageMutex.Unlock()
+
+	session, exists := ns.queueManager.GetSession(sessionID)
+	if !exists || session.State == SessionFinished {
+		return
+	}
+	text := ns.queueMessageText(session)
+	keyboard := ns.queueMessageKeyboard(session)
+
+	message, exists := ns.messageStore.Get(chatID, sessionID, MessageQueue)
+	if !exists {
+		if _, err := ns.postTracked(chatID, sessionID, MessageQueue, text, keyboard, false); err != nil {
+			log.Printf("Error sending queue message: %v", err)
+		}
+		return
+	}
+
+	if err := ns.editTracked(message, text, keyboard); err != nil {
+		log.Printf("Error updating queue message: %v", err)
+	}
+}
+
+// releaseSessionMessages stops tracking the registration messages of a
+// finished session and unpins them. The live queue message is handled by
+// stopLiveQueue.
+func (ns *NotificationService) releaseSessionMessages(sessionID string) {
+	for _, message := range ns.messageStore.ForSession(sessionID) {
+		if message.Kind == MessageLive {
+			continue
+		}
+		if _, _, err := ns.messageStore.Delete(message.ChatID, sessionID, message.Kind); err != nil {
+			log.Printf("Error forgetting %s message for %s: %v", message.Kind, sessionID, err)
+		}
+		if message.Pinned {
+			if err := ns.unpinMessage(message.ChatID, message.MessageID); err != nil {
+				log.Printf("Warning: Could not unpin %s message for %s: %v", message.Kind, sessionID, err)
+			}
+		}
+	}
+}
+
+func isMessageNotModified(err error) bool {
+	return strings.Contains(err.Error(), "message is not modified")
+}
+
+func isMessageNotFound(err error) bool {
+	return strings.Contains(err.Error(), "message to edit not found")
+}
+
+func isNotEnoughRights(err error) bool {
+	return strings.Contains(err.Error(), "not enough rights")
+}
+
+// postTracked posts a session message and remembers its ID, pinning it
+// when asked to.
+func (ns *NotificationService) postTracked(chatID int64, sessionID string, kind MessageKind, text string, keyboard *tgbotapi.InlineKeyboardMarkup, pin bool) (TrackedMessage, error) {
+	msg := ns.newMessage(chatID, text)
+	if keyboard != nil {
+		msg.ReplyMarkup = *keyboard
+	}
+	sentMsg, err := ns.bot.Send(msg)
+	if err != nil {
+		return TrackedMessage{}, err
+	}
+
+	message := TrackedMessage{ChatID: chatID, SessionID: sessionID, Kind: kind, MessageID: sentMsg.MessageID}
+	if pin {
+		switch err := ns.pinMessage(chatID, sentMsg.MessageID); {
+		case err == nil:
+			message.Pinned = true
+		case isNotEnoughRights(err):
+			log.Printf("Warning: Could not pin %s message for %s: the bot needs the \"Pin messages\" admin right in chat %d", kind, sessionID, chatID)
+		default:
+			log.Printf("Warning: Could not pin %s message for %s: %v", kind, sessionID, err)
+		}
+	}
+
+	// A message posted again replaces the old one, which must not stay
+	// pinned.
+	if previous, exists := ns.messageStore.Get(chatID, sessionID, kind); exists && previous.Pinned && previous.MessageID != message.MessageID {
+		if err := ns.unpinMessage(chatID, previous.MessageID); err != nil {
+			log.Printf("Warning: Could not unpin previous %s message for %s: %v", kind, sessionID, err)
+		}
+	}
+
+	if err := ns.messageStore.Set(message); err != nil {
+		log.Printf("Error saving %s message for %s: %v", kind, sessionID, err)
+	}
+	return message, nil
+}
+
+// editTracked updates a session message in place. If someone deleted it
+// from the chat, it is posted again and re-pinned if it was pinned.
+func (ns *NotificationService) editTracked(message TrackedMessage, text string, keyboard *tgbotapi.InlineKeyboardMarkup) error {
+	edit := ns.newEdit(message.ChatID, message.MessageID, text)
+	edit.ReplyMarkup = keyboard
+
+	_, err := ns.bot.Send(edit)
+	switch {
+	case err == nil, isMessageNotModified(err):
+		return nil
+	case isMessageNotFound(err):
+		log.Printf("⚠️ Сообщение %d для %s удалено из чата, публикуем заново", message.MessageID, message.SessionID)
+		_, err = ns.postTracked(message.ChatID, message.SessionID, message.Kind, text, keyboard, message.Pinned)
+		return err
+	default:
+		return err
+	}
+}
+
+func (ns *NotificationService) pinMessage(chatID int64, messageID int) error {
+	pin := tgbotapi.PinChatMessageConfig{
+		ChatID:              chatID,
+		MessageID:           messageID,
+		DisableNotification: true,
+	}
+	_, err := ns.bot.Request(pin)
+	return err
+}
+
+func (ns *NotificationService) unpinMessage(chatID int64, messageID int) error {
+	unpin := tgbotapi.UnpinChatMessageConfig{
+		ChatID:    chatID,
+		MessageID: messageID,
+	}
+	_, err := ns.bot.Request(unpin)
+	return err
+}
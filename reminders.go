@@ -0,0 +1,64 @@
+package main
+
+import (
+	"log"
+)
+
+const maxWarnAhead = 20
+
+func (ns *NotificationService) sendDirectMessage(subscription Subscription, text string) {
+	msg := ns.newMessage(subscription.ChatID, text)
+	if _, err := ns.bot.Send(msg); err != nil {
+		log.Printf("Error sending reminder to %s (%d): %v", subscription.RealName, subscription.UserID, err)
+	}
+}
+
+func (ns *NotificationService) remindOnClassStart(session Session) {
+	for _, realName := range session.Names() {
+		subscription, subscribed := ns.subscriptionStore.FindByRealName(realName)
+		if !subscribed {
+			continue
+		}
+
+		position, previousUser, found := ns.queueManager.GetQueueInfo(session.ID, realName)
+		if !found {
+			continue
+		}
+
+		text := ns.t("reminder.class_started", vars{"Subject": session.Subject.Name, "Position": position, "Previous": previousUser})
+		if position-1 <= subscription.WarnAhead {
+			ns.state.claimReminder(session.ID, subscription.UserID)
+		}
+		ns.sendDirectMessage(subscription, text)
+	}
+}
+
+func (ns *NotificationService) remindApproachingTurns(sessionID string) {
+	session, exists := ns.queueManager.GetSession(sessionID)
+	if !exists || session.State != SessionInProgress {
+		return
+	}
+
+	for _, entry := range session.Queue {
+		if entry.Status != EntryWaiting {
+			continue
+		}
+
+		subscription, subscribed := ns.subscriptionStore.FindByRealName(entry.Name)
+		if !subscribed {
+			continue
+		}
+
+		position, previousUser, found := ns.queueManager.GetQueueInfo(session.ID, entry.Name)
+		if !found || position-1 > subscription.WarnAhead {
+			continue
+		}
+
+		if !ns.state.claimReminder(session.ID, subscription.UserID) {
+			continue
+		}
+
+		text := ns.t("reminder.turn_approaching", vars{"Subject": session.Subject.Name, "Ahead": position - 1, "Previous": previousUser})
+		ns.sendDirectMessage(subscription, text)
+	}
+}
@@ -0,0 +1,524 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	icsImportHorizon   = 366 * 24 * time.Hour
+	icsMaxOccurrences  = 1000
+	icsDateTimeLayout  = "20060102T150405"
+	icsDateLayout      = "20060102"
+	icsUTCSuffixLayout = "20060102T150405Z"
+)
+
+var weekdayAbbrevs = map[time.Weekday]string{
+	time.Monday:    "пн",
+	time.Tuesday:   "вт",
+	time.Wednesday: "ср",
+	time.Thursday:  "чт",
+	time.Friday:    "пт",
+	time.Saturday:  "сб",
+	time.Sunday:    "вс",
+}
+
+var icsWeekdays = map[string]time.Weekday{
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+	"SU": time.Sunday,
+}
+
+// ICSSubjectMapping maps a VEVENT SUMMARY (case-insensitive substring) to a
+// subject name from the column mapping.
+type ICSSubjectMapping struct {
+	Summary  string `json:"summary"`
+	Subject  string `json:"subject"`
+	Policy   string `json:"policy,omitempty"`
+	Capacity int    `json:"capacity,omitempty"`
+}
+
+type icsProperty struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+type icsEvent struct {
+	uid          string
+	summary      string
+	status       string
+	start        time.Time
+	end          time.Time
+	rrule        string
+	exdates      []time.Time
+	exdays       []string
+	recurrenceID time.Time
+}
+
+func readICSLines(filename string) ([]string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s: %w", filename, err)
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", filename, err)
+	}
+	return lines, nil
+}
+
+func parseICSProperty(line string) (icsProperty, bool) {
+	colon := strings.Index(line, ":")
+	if colon < 0 {
+		return icsProperty{}, false
+	}
+
+	parts := strings.Split(line[:colon], ";")
+	prop := icsProperty{
+		name:   strings.ToUpper(parts[0]),
+		params: make(map[string]string),
+		value:  line[colon+1:],
+	}
+	for _, param := range parts[1:] {
+		if key, value, ok := strings.Cut(param, "="); ok {
+			prop.params[strings.ToUpper(key)] = strings.Trim(value, `"`)
+		}
+	}
+	return prop, true
+}
+
+func unescapeICSText(s string) string {
+	replacer := strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`)
+	return replacer.Replace(s)
+}
+
+// parseICSTime handles UTC, TZID-qualified and floating date-times. Floating
+// times and unknown zones are interpreted in the bot's time zone.
+func parseICSTime(value string, params map[string]string) (time.Time, bool, error) {
+	if params["VALUE"] == "DATE" || len(value) == len(icsDateLayout) {
+		t, err := time.ParseInLocation(icsDateLayout, value, getLocation())
+		return t, true, err
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse(icsUTCSuffixLayout, value)
+		return t.In(getLocation()), false, err
+	}
+
+	location := getLocation()
+	if tzid := params["TZID"]; tzid != "" {
+		if loaded, err := time.LoadLocation(tzid); err == nil {
+			location = loaded
+		} else {
+			log.Printf("Warning: unknown TZID %q in schedule, using default time zone", tzid)
+		}
+	}
+	t, err := time.ParseInLocation(icsDateTimeLayout, value, location)
+	return t.In(getLocation()), false, err
+}
+
+func parseICSEvents(lines []string) ([]icsEvent, error) {
+	var events []icsEvent
+	var current *icsEvent
+
+	for i, line := range lines {
+		prop, ok := parseICSProperty(line)
+		if !ok {
+			continue
+		}
+
+		switch {
+		case prop.name == "BEGIN" && strings.EqualFold(prop.value, "VEVENT"):
+			current = &icsEvent{}
+			continue
+		case prop.name == "END" && strings.EqualFold(prop.value, "VEVENT"):
+			if current != nil {
+				events = append(events, *current)
+			}
+			current = nil
+			continue
+		}
+		if current == nil {
+			continue
+		}
+
+		switch prop.name {
+		case "UID":
+			current.uid = prop.value
+		case "SUMMARY":
+			current.summary = unescapeICSText(prop.value)
+		case "STATUS":
+			current.status = strings.ToUpper(prop.value)
+		case "RRULE":
+			current.rrule = prop.value
+		case "DTSTART", "DTEND", "RECURRENCE-ID":
+			t, allDay, err := parseICSTime(prop.value, prop.params)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid %s %q: %w", i+1, prop.name, prop.value, err)
+			}
+			if allDay {
+				// All-day events are not classes; leave them without a time.
+				continue
+			}
+			switch prop.name {
+			case "DTSTART":
+				current.start = t
+			case "DTEND":
+				current.end = t
+			default:
+				current.recurrenceID = t
+			}
+		case "EXDATE":
+			for _, value := range strings.Split(prop.value, ",") {
+				t, allDay, err := parseICSTime(value, prop.params)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: invalid EXDATE %q: %w", i+1, value, err)
+				}
+				if allDay {
+					current.exdays = append(current.exdays, t.Format(icsDateLayout))
+					continue
+				}
+				current.exdates = append(current.exdates, t)
+			}
+		}
+	}
+
+	return events, nil
+}
+
+// expandICSEvent returns the start times of all occurrences of a recurring
+// event up to until. Only DAILY and WEEKLY rules are supported, which is all
+// a university timetable uses.
+func expandICSEvent(event icsEvent, until time.Time) ([]time.Time, error) {
+	if event.rrule == "" {
+		return []time.Time{event.start}, nil
+	}
+
+	freq, interval, count := "", 1, 0
+	var byDay []time.Weekday
+	for _, part := range strings.Split(event.rrule, ";") {
+		key, value, _ := strings.Cut(part, "=")
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			freq = strings.ToUpper(value)
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid INTERVAL %q", value)
+			}
+			interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid COUNT %q", value)
+			}
+			count = n
+		case "UNTIL":
+			t, _, err := parseICSTime(value, nil)
+			if err != nil {
+				return nil, fmt.Errorf("invalid UNTIL %q: %w", value, err)
+			}
+			if len(value) == len(icsDateLayout) {
+				t = t.AddDate(0, 0, 1).Add(-time.Second)
+			}
+			if t.Before(until) {
+				until = t
+			}
+		case "BYDAY":
+			for _, day := range strings.Split(value, ",") {
+				weekday, ok := icsWeekdays[strings.ToUpper(strings.TrimSpace(day))]
+				if !ok {
+					return nil, fmt.Errorf("unsupported BYDAY %q", day)
+				}
+				byDay = append(byDay, weekday)
+			}
+		}
+	}
+
+	var step time.Duration
+	switch freq {
+	case "DAILY":
+		step = 1
+	case "WEEKLY":
+		step = 7
+		if len(byDay) == 0 {
+			byDay = []time.Weekday{event.start.Weekday()}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported FREQ %q", freq)
+	}
+
+	var occurrences []time.Time
+	for period := 0; len(occurrences) < icsMaxOccurrences; period++ {
+		periodStart := event.start.AddDate(0, 0, period*interval*int(step))
+		if periodStart.After(until) {
+			break
+		}
+
+		candidates := []time.Time{periodStart}
+		if freq == "WEEKLY" {
+			weekStart := periodStart.AddDate(0, 0, -(int(periodStart.Weekday())+6)%7)
+			candidates = candidates[:0]
+			for _, weekday := range byDay {
+				candidates = append(candidates, weekStart.AddDate(0, 0, (int(weekday)+6)%7))
+			}
+			sort.Slice(candidates, func(i, j int) bool { return candidates[i].Before(candidates[j]) })
+		}
+
+		for _, candidate := range candidates {
+			if candidate.Before(event.start) || candidate.After(until) {
+				continue
+			}
+			occurrences = append(occurrences, candidate)
+			if count > 0 && len(occurrences) == count {
+				return occurrences, nil
+			}
+		}
+	}
+	return occurrences, nil
+}
+
+func isExcluded(t time.Time, exdates []time.Time) bool {
+	for _, exdate := range exdates {
+		if exdate.Equal(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// excludes reports whether EXDATE removes an occurrence. A date-only EXDATE
+// removes the occurrence on that calendar day, whatever its start time.
+func (event icsEvent) excludes(start time.Time) bool {
+	day := start.In(getLocation()).Format(icsDateLayout)
+	for _, exday := range event.exdays {
+		if exday == day {
+			return true
+		}
+	}
+	return isExcluded(start, event.exdates)
+}
+
+// validateICSMappings checks the mapping file as strictly as parseSubjects
+// checks queue_lessons.txt and reports every problem at once.
+func validateICSMappings(mappings []ICSSubjectMapping, knownSubject func(string) bool) error {
+	var errs []error
+	for i, mapping := range mappings {
+		addError := func(format string, args ...any) {
+			errs = append(errs, fmt.Errorf("mapping %d (%q): %s", i+1, mapping.Summary, fmt.Sprintf(format, args...)))
+		}
+
+		if strings.TrimSpace(mapping.Summary) == "" {
+			addError("summary is empty")
+		}
+		if mapping.Subject == "" {
+			addError("subject name is empty")
+		} else if !knownSubject(mapping.Subject) {
+			addError("unknown subject %q: no short code / sheet column is configured for it", mapping.Subject)
+		}
+		if mapping.Policy != "" && !isKnownPolicy(strings.ToLower(mapping.Policy)) {
+			addError("unknown ordering policy %q", mapping.Policy)
+		}
+		if mapping.Capacity < 0 {
+			addError("invalid capacity %d (expected a non-negative number)", mapping.Capacity)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func matchICSSubject(summary string, mappings []ICSSubjectMapping) (ICSSubjectMapping, bool) {
+	summary = strings.ToLower(summary)
+	for _, mapping := range mappings {
+		if mapping.Summary != "" && strings.Contains(summary, strings.ToLower(mapping.Summary)) {
+			return mapping, true
+		}
+	}
+	return ICSSubjectMapping{}, false
+}
+
+// subjectsFromICS groups occurrences by subject, weekday and time so that
+// each Subject keeps the Day/Start/End shape of queue_lessons.txt rows.
+func subjectsFromICS(events []icsEvent, mappings []ICSSubjectMapping, now time.Time) ([]Subject, error) {
+	overridden := make(map[string][]time.Time)
+	for _, event := range events {
+		if !event.recurrenceID.IsZero() {
+			overridden[event.uid] = append(overridden[event.uid], event.recurrenceID)
+		}
+	}
+
+	grouped := make(map[string]*Subject)
+	var order []string
+	skipped := make(map[string]bool)
+	until := now.Add(icsImportHorizon)
+
+	for _, event := range events {
+		if event.start.IsZero() || event.status == "CANCELLED" {
+			continue
+		}
+		mapping, ok := matchICSSubject(event.summary, mappings)
+		if !ok {
+			skipped[event.summary] = true
+			continue
+		}
+
+		duration := event.end.Sub(event.start)
+		if event.end.IsZero() || duration <= 0 {
+			return nil, fmt.Errorf("event %q (%s) has no valid DTEND", event.summary, event.start.Format("2006-01-02 15:04"))
+		}
+
+		occurrences, err := expandICSEvent(event, until)
+		if err != nil {
+			return nil, fmt.Errorf("event %q: %w", event.summary, err)
+		}
+
+		for _, start := range occurrences {
+			if event.recurrenceID.IsZero() && (event.excludes(start) || isExcluded(start, overridden[event.uid])) {
+				continue
+			}
+
+			end := start.Add(duration)
+			subject := Subject{
+				Day:      weekdayAbbrevs[start.Weekday()],
+				Start:    start.Format("15:04"),
+				Name:     mapping.Subject,
+				End:      end.Format("15:04"),
+				Policy:   PolicyFIFO,
+				Capacity: mapping.Capacity,
+			}
+			if mapping.Policy != "" {
+				subject.Policy = strings.ToLower(mapping.Policy)
+			}
+
+			key := strings.Join([]string{subject.Name, subject.Day, subject.Start, subject.End}, "|")
+			existing, exists := grouped[key]
+			if !exists {
+				existing = &subject
+				grouped[key] = existing
+				order = append(order, key)
+			}
+			existing.Occurrences = append(existing.Occurrences, start)
+		}
+	}
+
+	for summary := range skipped {
+		log.Printf("Schedule: skipping events %q (no subject mapping)", summary)
+	}
+
+	subjects := make([]Subject, 0, len(order))
+	for _, key := range order {
+		subject := grouped[key]
+		sort.Slice(subject.Occurrences, func(i, j int) bool {
+			return subject.Occurrences[i].Before(subject.Occurrences[j])
+		})
+		subjects = append(subjects, *subject)
+	}
+	return subjects, nil
+}
+
+// LoadSubjectsFromICS is an alternative to LoadSubjects for timetables
+// published as iCalendar files.
+func (qm *QueueManager) LoadSubjectsFromICS(filename, mappingFile string) error {
+	var mappings []ICSSubjectMapping
+	if err := loadJSONFile(mappingFile, &mappings); err != nil {
+		return fmt.Errorf("error loading schedule mapping %s: %w", mappingFile, err)
+	}
+	if err := validateICSMappings(mappings, qm.knownSubject); err != nil {
+		return fmt.Errorf("invalid schedule mapping %s:\n%w", mappingFile, err)
+	}
+
+	lines, err := readICSLines(filename)
+	if err != nil {
+		return err
+	}
+	events, err := parseICSEvents(lines)
+	if err != nil {
+		return fmt.Errorf("error parsing %s: %w", filename, err)
+	}
+
+	subjects, err := subjectsFromICS(events, mappings, getLocalTime())
+	if err != nil {
+		return fmt.Errorf("error parsing %s: %w", filename, err)
+	}
+
+	qm.mu.Lock()
+	qm.subjects = subjects
+	qm.mu.Unlock()
+
+	log.Printf("Loaded %d subjects from %s (%d events)", len(subjects), filename, len(events))
+	return nil
+}
+
+func nextOccurrence(subject Subject, now time.Time) *time.Time {
+	now = now.Truncate(time.Minute)
+	for _, occurrence := range subject.Occurrences {
+		if !occurrence.Before(now) {
+			next := occurrence
+			return &next
+		}
+	}
+	return nil
+}
+
+// previousSubjectTime returns the occurrence before next, which is the class
+// that may still be running.
+func previousSubjectTime(subject Subject, next time.Time) (time.Time, bool) {
+	if len(subject.Overrides) > 0 {
+		starts := effectiveStarts(subject, next.AddDate(0, 0, -maxRescheduleDays-7), next)
+		if len(starts) == 0 {
+			return time.Time{}, false
+		}
+		return starts[len(starts)-1], true
+	}
+	if len(subject.Occurrences) == 0 {
+		return next.AddDate(0, 0, -7), true
+	}
+	for i := len(subject.Occurrences) - 1; i >= 0; i-- {
+		if subject.Occurrences[i].Before(next) {
+			return subject.Occurrences[i], true
+		}
+	}
+	return time.Time{}, false
+}
+
+// upcomingSubjectTimes returns start times from next until the given moment.
+func upcomingSubjectTimes(subject Subject, next, until time.Time) []time.Time {
+	if len(subject.Overrides) > 0 {
+		return effectiveStarts(subject, next, until)
+	}
+	var times []time.Time
+	if len(subject.Occurrences) == 0 {
+		for start := next; start.Before(until); start = start.AddDate(0, 0, 7) {
+			times = append(times, start)
+		}
+		return times
+	}
+	for _, occurrence := range subject.Occurrences {
+		if !occurrence.Before(next) && occurrence.Before(until) {
+			times = append(times, occurrence)
+		}
+	}
+	return times
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func icsLocal(value string) time.Time {
+	t, err := time.ParseInLocation("2006-01-02 15:04", value, getLocation())
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func formatStarts(starts []time.Time) []string {
+	formatted := make([]string, len(starts))
+	for i, start := range starts {
+		formatted[i] = start.In(getLocation()).Format("2006-01-02 15:04")
+	}
+	return formatted
+}
+
+func TestExpandICSEvent(t *testing.T) {
+	// 2026-03-02 is a Monday.
+	start := icsLocal("2026-03-02 10:00")
+	horizon := icsLocal("2027-01-01 00:00")
+
+	tests := []struct {
+		name  string
+		rrule string
+		want  []string
+	}{
+		{"daily count", "FREQ=DAILY;COUNT=3", []string{"2026-03-02 10:00", "2026-03-03 10:00", "2026-03-04 10:00"}},
+		{"daily interval until date", "FREQ=DAILY;INTERVAL=2;UNTIL=20260306", []string{"2026-03-02 10:00", "2026-03-04 10:00", "2026-03-06 10:00"}},
+		{"weekly count", "FREQ=WEEKLY;COUNT=3", []string{"2026-03-02 10:00", "2026-03-09 10:00", "2026-03-16 10:00"}},
+		{"weekly byday count", "FREQ=WEEKLY;BYDAY=MO,TH;COUNT=4", []string{"2026-03-02 10:00", "2026-03-05 10:00", "2026-03-09 10:00", "2026-03-12 10:00"}},
+		{"biweekly until utc", "FREQ=WEEKLY;INTERVAL=2;UNTIL=20260330T070000Z", []string{"2026-03-02 10:00", "2026-03-16 10:00", "2026-03-30 10:00"}},
+		{"weekly until before last", "FREQ=WEEKLY;UNTIL=20260316T065959Z", []string{"2026-03-02 10:00", "2026-03-09 10:00"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			starts, err := expandICSEvent(icsEvent{start: start, rrule: tt.rrule}, horizon)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := formatStarts(starts); strings.Join(got, ", ") != strings.Join(tt.want, ", ") {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestICSExdates(t *testing.T) {
+	tests := []struct {
+		name   string
+		exdate string
+		want   []string
+	}{
+		{"date-time", "EXDATE;TZID=Europe/Moscow:20260309T100000", []string{"2026-03-02 10:00", "2026-03-16 10:00"}},
+		{"utc date-time", "EXDATE:20260309T070000Z", []string{"2026-03-02 10:00", "2026-03-16 10:00"}},
+		{"date", "EXDATE;VALUE=DATE:20260309,20260316", []string{"2026-03-02 10:00"}},
+		{"other time same day", "EXDATE;TZID=Europe/Moscow:20260309T120000", []string{"2026-03-02 10:00", "2026-03-09 10:00", "2026-03-16 10:00"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, err := parseICSEvents([]string{
+				"BEGIN:VEVENT",
+				"UID:lab-1",
+				"SUMMARY:Лабораторная работа",
+				"DTSTART;TZID=Europe/Moscow:20260302T100000",
+				"DTEND;TZID=Europe/Moscow:20260302T113000",
+				"RRULE:FREQ=WEEKLY;COUNT=3",
+				tt.exdate,
+				"END:VEVENT",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			mappings := []ICSSubjectMapping{{Summary: "лабораторная", Subject: testSubject}}
+			subjects, err := subjectsFromICS(events, mappings, icsLocal("2026-03-01 00:00"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(subjects) != 1 {
+				t.Fatalf("got %d subjects, want 1", len(subjects))
+			}
+			if got := formatStarts(subjects[0].Occurrences); strings.Join(got, ", ") != strings.Join(tt.want, ", ") {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseICSTimeZones(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  string
+		params map[string]string
+		want   string
+	}{
+		{"tzid", "20260302T100000", map[string]string{"TZID": "Europe/Berlin"}, "2026-03-02 12:00"},
+		{"tzid across midnight", "20260302T230000", map[string]string{"TZID": "America/New_York"}, "2026-03-03 07:00"},
+		{"utc", "20260302T100000Z", nil, "2026-03-02 13:00"},
+		{"floating", "20260302T100000", nil, "2026-03-02 10:00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, allDay, err := parseICSTime(tt.value, tt.params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if allDay {
+				t.Fatal("parsed as a date")
+			}
+			if formatted := got.In(getLocation()).Format("2006-01-02 15:04"); formatted != tt.want {
+				t.Errorf("got %s, want %s", formatted, tt.want)
+			}
+		})
+	}
+}
+
+func TestICSMappingsAreStrict(t *testing.T) {
+	known := func(name string) bool { return name == testSubject }
+	mappings := []ICSSubjectMapping{
+		{Summary: "лаб", Subject: testSubject, Policy: "lottery"},
+		{Summary: "семинар", Subject: "Неизвестный предмет"},
+		{Summary: "практика", Subject: testSubject, Policy: "random"},
+	}
+	err := validateICSMappings(mappings, known)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, want := range []string{"Неизвестный предмет", `"random"`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %s", err, want)
+		}
+	}
+	if err := validateICSMappings(mappings[:1], known); err != nil {
+		t.Errorf("valid mapping rejected: %v", err)
+	}
+}
@@ -0,0 +1,487 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	overrideDateLayout = "2006-01-02"
+	// maxRescheduleDays bounds how far a class can be moved.
+	maxRescheduleDays = 30
+)
+
+// ScheduleOverride cancels the class on Date or moves it to NewStart.
+type ScheduleOverride struct {
+	Subject   string    `json:"subject"`
+	Date      string    `json:"date"`
+	Cancelled bool      `json:"cancelled,omitempty"`
+	NewStart  time.Time `json:"new_start,omitzero"`
+}
+
+func (qm *QueueManager) LoadScheduleOverrides(filename string) error {
+	var overrides []ScheduleOverride
+	if err := loadJSONFile(filename, &overrides); err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("error loading schedule overrides from %s: %w", filename, err)
+		}
+		log.Printf("Schedule overrides file %s not found, using the regular schedule", filename)
+	}
+
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+
+	qm.overridesFile = filename
+	qm.overrides = make(map[string]map[string]ScheduleOverride)
+	for _, override := range overrides {
+		if qm.overrides[override.Subject] == nil {
+			qm.overrides[override.Subject] = make(map[string]ScheduleOverride)
+		}
+		qm.overrides[override.Subject][override.Date] = override
+	}
+
+	log.Printf("Loaded %d schedule overrides", len(overrides))
+	return nil
+}
+
+func (qm *QueueManager) SetScheduleOverride(override ScheduleOverride) error {
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+
+	// GetSubjects hands out the per-subject maps, so replace rather than modify.
+	updated := make(map[string]ScheduleOverride, len(qm.overrides[override.Subject])+1)
+	for date, existing := range qm.overrides[override.Subject] {
+		updated[date] = existing
+	}
+	updated[override.Date] = override
+	if qm.overrides == nil {
+		qm.overrides = make(map[string]map[string]ScheduleOverride)
+	}
+	qm.overrides[override.Subject] = updated
+
+	var overrides []ScheduleOverride
+	for _, bySubject := range qm.overrides {
+		for _, existing := range bySubject {
+			overrides = append(overrides, existing)
+		}
+	}
+	sort.Slice(overrides, func(i, j int) bool {
+		if overrides[i].Date != overrides[j].Date {
+			return overrides[i].Date < overrides[j].Date
+		}
+		return overrides[i].Subject < overrides[j].Subject
+	})
+
+	if err := saveJSONFile(qm.overridesFile, overrides); err != nil {
+		return fmt.Errorf("error saving schedule overrides to %s: %w", qm.overridesFile, err)
+	}
+	return nil
+}
+
+// RemoveSession drops a session from memory without touching the sheet.
+func (qm *QueueManager) RemoveSession(sessionID string) (Session, bool) {
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+
+	session, exists := qm.sessions[sessionID]
+	if !exists {
+		return Session{}, false
+	}
+	delete(qm.sessions, sessionID)
+	log.Printf("🚫 Сессия %s удалена", sessionID)
+	return session.clone(), true
+}
+
+func isMovable(state SessionState) bool {
+	return state == SessionScheduled || state == SessionOpen
+}
+
+// MoveSession gives a scheduled or open session new times and the matching
+// ID. Its state is kept; advanceSessions moves it on from there.
+func (qm *QueueManager) MoveSession(sessionID string, start, end, registrationOpens, registrationCloses time.Time) (Session, error) {
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+
+	session, exists := qm.sessions[sessionID]
+	if !exists {
+		return Session{}, fmt.Errorf("session not found: %s", sessionID)
+	}
+	if !isMovable(session.State) {
+		return Session{}, fmt.Errorf("session %s is %s and cannot be moved", sessionID, session.State)
+	}
+
+	id := newSessionID(qm.sessionCode(session.Subject.Name), start)
+	if _, taken := qm.sessions[id]; taken && id != sessionID {
+		return Session{}, fmt.Errorf("session %s already exists", id)
+	}
+
+	delete(qm.sessions, sessionID)
+	session.ID = id
+	session.Start = start
+	session.End = end
+	session.OpensAt = registrationOpens
+	session.ClosesAt = registrationCloses
+	qm.sessions[id] = session
+
+	log.Printf("🔁 Сессия %s перенесена в %s", sessionID, id)
+	return session.clone(), nil
+}
+
+// regularStarts returns the start times in [from, until) before overrides.
+func regularStarts(subject Subject, from, until time.Time) []time.Time {
+	var starts []time.Time
+	if len(subject.Occurrences) > 0 {
+		for _, occurrence := range subject.Occurrences {
+			if !occurrence.Before(from) && occurrence.Before(until) {
+				starts = append(starts, occurrence)
+			}
+		}
+		return starts
+	}
+
+	startTime, err := time.Parse("15:04", subject.Start)
+	if err != nil {
+		return nil
+	}
+	weekday := parseWeekday(subject.Day)
+	if weekday == -1 {
+		return nil
+	}
+
+	loc := getLocation()
+	from = from.In(loc)
+	start := time.Date(from.Year(), from.Month(), from.Day(), startTime.Hour(), startTime.Minute(), 0, 0, loc)
+	start = start.AddDate(0, 0, (int(weekday)-int(start.Weekday())+7)%7)
+	if start.Before(from) {
+		start = start.AddDate(0, 0, 7)
+	}
+	for ; start.Before(until); start = start.AddDate(0, 0, 7) {
+		starts = append(starts, start)
+	}
+	return starts
+}
+
+// effectiveStarts returns the start times in [from, until) after overrides.
+func effectiveStarts(subject Subject, from, until time.Time) []time.Time {
+	var starts []time.Time
+	for _, start := range regularStarts(subject, from.AddDate(0, 0, -maxRescheduleDays), until.AddDate(0, 0, maxRescheduleDays)) {
+		override, exists := subject.Overrides[start.In(getLocation()).Format(overrideDateLayout)]
+		switch {
+		case exists && override.Cancelled:
+			continue
+		case exists:
+			start = override.NewStart.In(getLocation())
+		}
+		if !start.Before(from) && start.Before(until) {
+			starts = append(starts, start)
+		}
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i].Before(starts[j]) })
+	return starts
+}
+
+func nextEffectiveStart(subject Subject, now time.Time) *time.Time {
+	now = now.Truncate(time.Minute)
+	starts := effectiveStarts(subject, now, now.AddDate(1, 0, 0))
+	if len(starts) == 0 {
+		return nil
+	}
+	return &starts[0]
+}
+
+func subjectDuration(subject Subject) (time.Duration, error) {
+	start, err := time.Parse("15:04", subject.Start)
+	if err != nil {
+		return 0, err
+	}
+	end, err := time.Parse("15:04", subject.End)
+	if err != nil {
+		return 0, err
+	}
+	return end.Sub(start), nil
+}
+
+// findClass finds the subject entry with a class on the given day, where it
+// was moved to or regularly is, and returns it with the regular class start.
+func (ns *NotificationService) findClass(subjectName string, day time.Time) (Subject, time.Time, bool) {
+	subjects := ns.queueManager.GetSubjects()
+	for _, subject := range subjects {
+		if subject.Name != subjectName {
+			continue
+		}
+		for _, start := range effectiveStarts(subject, day, day.AddDate(0, 0, 1)) {
+			if regular, found := regularStart(subject, start); found {
+				return subject, regular, true
+			}
+		}
+	}
+	for _, subject := range subjects {
+		if subject.Name != subjectName {
+			continue
+		}
+		if starts := regularStarts(subject, day, day.AddDate(0, 0, 1)); len(starts) > 0 {
+			return subject, starts[0], true
+		}
+	}
+	return Subject{}, time.Time{}, false
+}
+
+// regularStart maps an effective class start back to its regular start.
+func regularStart(subject Subject, start time.Time) (time.Time, bool) {
+	for date, override := range subject.Overrides {
+		if override.Cancelled || !override.NewStart.Equal(start) {
+			continue
+		}
+		day, err := time.ParseInLocation(overrideDateLayout, date, getLocation())
+		if err != nil {
+			return time.Time{}, false
+		}
+		if starts := regularStarts(subject, day, day.AddDate(0, 0, 1)); len(starts) > 0 {
+			return starts[0], true
+		}
+		return time.Time{}, false
+	}
+	return start, true
+}
+
+func (ns *NotificationService) parseOverrideClass(message *tgbotapi.Message, code, date string) (Subject, time.Time, bool) {
+	subjectName := ns.findSubjectByShortCode(code)
+	if subjectName == "" {
+		ns.reply(message, ns.t("common.subject_not_found", vars{"Code": code}))
+		return Subject{}, time.Time{}, false
+	}
+
+	day, err := time.ParseInLocation(overrideDateLayout, date, getLocation())
+	if err != nil {
+		ns.reply(message, ns.t("override.bad_date", nil))
+		return Subject{}, time.Time{}, false
+	}
+
+	subject, start, found := ns.findClass(subjectName, day)
+	if !found {
+		ns.reply(message, ns.t("override.no_class", vars{"Subject": subjectName, "Date": day.Format("02.01")}))
+		return Subject{}, time.Time{}, false
+	}
+	return subject, start, true
+}
+
+// overridableSession returns the session of a class that has not started.
+func (ns *NotificationService) overridableSession(message *tgbotapi.Message, subject Subject, start time.Time) (Session, bool, bool) {
+	start = currentStart(subject, start)
+	session, exists := ns.queueManager.GetSession(newSessionID(ns.queueManager.sessionCode(subject.Name), start))
+	if !exists {
+		return Session{}, false, true
+	}
+	if session.State == SessionInProgress || session.State == SessionFinished {
+		ns.reply(message, ns.t("override.already_started", nil))
+		return Session{}, false, false
+	}
+	return session, true, true
+}
+
+// retireSessionMessages replaces the registration messages with a notice.
+func (ns *NotificationService) retireSessionMessages(sessionID, text string) {
+	for _, message := range ns.messageStore.ForSession(sessionID) {
+		if message.Kind == MessageLive {
+			continue
+		}
+		if _, err := ns.bot.Send(ns.newEdit(message.ChatID, message.MessageID, text)); err != nil && !isMessageNotModified(err) && !isMessageNotFound(err) {
+			log.Printf("Error updating %s message for %s: %v", message.Kind, sessionID, err)
+		}
+	}
+	ns.releaseSessionMessages(sessionID)
+}
+
+func (ns *NotificationService) handleCancelCommand(message *tgbotapi.Message) {
+	if !ns.isAdmin(ns.config.QueueChatID, message.From.ID) {
+		ns.reply(message, ns.t("override.admin_only", nil))
+		return
+	}
+
+	args := strings.Fields(message.CommandArguments())
+	if len(args) != 2 {
+		ns.reply(message, ns.t("override.cancel_usage", nil))
+		return
+	}
+
+	subject, start, ok := ns.parseOverrideClass(message, args[0], args[1])
+	if !ok {
+		return
+	}
+	session, hasSession, ok := ns.overridableSession(message, subject, start)
+	if !ok {
+		return
+	}
+
+	override := ScheduleOverride{Subject: subject.Name, Date: start.Format(overrideDateLayout), Cancelled: true}
+	if err := ns.queueManager.SetScheduleOverride(override); err != nil {
+		log.Printf("Error cancelling %s on %s: %v", subject.Name, override.Date, err)
+		ns.reply(message, ns.t("override.save_error", nil))
+		return
+	}
+
+	next := ""
+	if subject, _, found := ns.findClass(subject.Name, start); found {
+		if nextStart := GetNextSubjectTime(subject); nextStart != nil {
+			next = nextStart.Format("02.01 15:04")
+		}
+	}
+	text := ns.t("override.cancelled", vars{
+		"Subject": subject.Name,
+		"Date":    currentStart(subject, start).Format("02.01 15:04"),
+		"Queue":   len(session.Queue),
+		"Next":    next,
+	})
+
+	// The queue stays in the sheet column for the next class to pick up.
+	if hasSession {
+		ns.queueManager.RemoveSession(session.ID)
+		if err := ns.stateStore.ForgetActiveSession(session.ID); err != nil {
+			log.Printf("Error forgetting session %s: %v", session.ID, err)
+		}
+		ns.state.forgetReminders(session.ID)
+		ns.retireSessionMessages(session.ID, text)
+	}
+	ns.scheduleUpcomingSessions()
+
+	log.Printf("🚫 Занятие %s %s отменено", subject.Name, override.Date)
+	if _, err := ns.bot.Send(ns.newMessage(ns.config.QueueChatID, text)); err != nil {
+		log.Printf("Error sending cancellation notice: %v", err)
+	}
+	if message.Chat.ID != ns.config.QueueChatID {
+		ns.reply(message, text)
+	}
+}
+
+func (ns *NotificationService) handleRescheduleCommand(message *tgbotapi.Message) {
+	if !ns.isAdmin(ns.config.QueueChatID, message.From.ID) {
+		ns.reply(message, ns.t("override.admin_only", nil))
+		return
+	}
+
+	args := strings.Fields(message.CommandArguments())
+	if len(args) != 4 {
+		ns.reply(message, ns.t("override.reschedule_usage", nil))
+		return
+	}
+
+	subject, start, ok := ns.parseOverrideClass(message, args[0], args[1])
+	if !ok {
+		return
+	}
+	newStart, err := time.ParseInLocation(overrideDateLayout+" 15:04", args[2]+" "+args[3], getLocation())
+	if err != nil {
+		ns.reply(message, ns.t("override.bad_date", nil))
+		return
+	}
+	if !newStart.After(getLocalTime()) {
+		ns.reply(message, ns.t("override.in_past", nil))
+		return
+	}
+	if !ns.canMoveClass(subject, start, newStart) {
+		ns.reply(message, ns.t("override.too_far", vars{"Days": maxRescheduleDays}))
+		return
+	}
+	duration, err := subjectDuration(subject)
+	if err != nil {
+		log.Printf("Error parsing class times for %s: %v", subject.Name, err)
+		ns.reply(message, ns.t("override.save_error", nil))
+		return
+	}
+
+	session, hasSession, ok := ns.overridableSession(message, subject, start)
+	if !ok {
+		return
+	}
+	if hasSession && !isMovable(session.State) {
+		ns.reply(message, ns.t("override.registration_closed", nil))
+		return
+	}
+
+	override := ScheduleOverride{Subject: subject.Name, Date: start.Format(overrideDateLayout), NewStart: newStart}
+	if err := ns.queueManager.SetScheduleOverride(override); err != nil {
+		log.Printf("Error rescheduling %s on %s: %v", subject.Name, override.Date, err)
+		ns.reply(message, ns.t("override.save_error", nil))
+		return
+	}
+
+	text := ns.t("override.rescheduled", vars{
+		"Subject": subject.Name,
+		"From":    currentStart(subject, start).Format("02.01 15:04"),
+		"To":      newStart.Format("02.01 15:04"),
+		"Queue":   len(session.Queue),
+	})
+
+	if hasSession {
+		moved, err := ns.queueManager.MoveSession(session.ID, newStart, newStart.Add(duration), ns.registrationOpenTime(newStart), ns.registrationCloseTime(subject, newStart))
+		if err != nil {
+			log.Printf("Error moving session %s: %v", session.ID, err)
+		} else {
+			ns.state.forgetReminders(session.ID)
+			ns.retireSessionMessages(session.ID, text)
+			if err := ns.stateStore.ForgetActiveSession(session.ID); err != nil {
+				log.Printf("Error forgetting session %s: %v", session.ID, err)
+			}
+			if moved.State == SessionOpen {
+				if err := ns.stateStore.SaveActiveSession(moved); err != nil {
+					log.Printf("Error saving session %s: %v", moved.ID, err)
+				}
+				ns.sendQueueNotification(moved)
+			}
+			if len(moved.Queue) > 0 {
+				ns.updateOrCreateQueueMessage(ns.config.QueueChatID, moved)
+			}
+		}
+	}
+	ns.scheduleUpcomingSessions()
+
+	log.Printf("🔁 Занятие %s %s перенесено на %s", subject.Name, override.Date, newStart.Format("2006-01-02 15:04"))
+	if _, err := ns.bot.Send(ns.newMessage(ns.config.QueueChatID, text)); err != nil {
+		log.Printf("Error sending reschedule notice: %v", err)
+	}
+	if message.Chat.ID != ns.config.QueueChatID {
+		ns.reply(message, text)
+	}
+}
+
+// canMoveClass keeps a moved class between its neighbours, since the sheet
+// column holds a single queue per subject.
+func (ns *NotificationService) canMoveClass(subject Subject, start, newStart time.Time) bool {
+	limit := time.Duration(maxRescheduleDays) * 24 * time.Hour
+	if newStart.Sub(start) > limit || start.Sub(newStart) > limit {
+		return false
+	}
+
+	overrides := make(map[string]ScheduleOverride, len(subject.Overrides))
+	for date, override := range subject.Overrides {
+		overrides[date] = override
+	}
+	delete(overrides, start.Format(overrideDateLayout))
+	subject.Overrides = overrides
+
+	from, until := start, newStart
+	if newStart.Before(start) {
+		from, until = newStart, start
+	}
+	for _, other := range effectiveStarts(subject, from, until.Add(time.Minute)) {
+		if !other.Equal(start) {
+			return false
+		}
+	}
+	return true
+}
+
+// currentStart applies an earlier move of the class regularly at start.
+func currentStart(subject Subject, start time.Time) time.Time {
+	if override, exists := subject.Overrides[start.Format(overrideDateLayout)]; exists && !override.NewStart.IsZero() {
+		return override.NewStart.In(getLocation())
+	}
+	return start
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFindClassByMovedDate(t *testing.T) {
+	ns, _, _ := newTestService(t, 1, QueueMessageSeparate)
+	regular := openSession(t, ns).Start
+	if err := ns.queueManager.LoadScheduleOverrides(filepath.Join(t.TempDir(), "overrides.json")); err != nil {
+		t.Fatal(err)
+	}
+
+	moved := regular.AddDate(0, 0, 1).Add(4 * time.Hour)
+	override := ScheduleOverride{Subject: testSubject, Date: regular.Format(overrideDateLayout), NewStart: moved}
+	if err := ns.queueManager.SetScheduleOverride(override); err != nil {
+		t.Fatal(err)
+	}
+
+	day := func(t time.Time) time.Time {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, getLocation())
+	}
+	for _, lookup := range []time.Time{moved, regular} {
+		_, start, found := ns.findClass(testSubject, day(lookup))
+		if !found || !start.Equal(regular) {
+			t.Errorf("class on %s: found %v at %s, want the regular start %s", lookup.Format("02.01"), found, start, regular)
+		}
+	}
+	if _, _, found := ns.findClass(testSubject, day(regular.AddDate(0, 0, 2))); found {
+		t.Error("found a class on a day without one")
+	}
+}
+
+func TestEffectiveStarts(t *testing.T) {
+	// Mondays at 10:00; 2026-03-02 is a Monday.
+	subject := Subject{Day: "пн", Start: "10:00", Name: testSubject, End: "11:30"}
+	from, until := icsLocal("2026-03-02 00:00"), icsLocal("2026-03-30 00:00")
+	moved := func(date, newStart string) ScheduleOverride {
+		return ScheduleOverride{Subject: testSubject, Date: date, NewStart: icsLocal(newStart)}
+	}
+
+	tests := []struct {
+		name      string
+		overrides []ScheduleOverride
+		want      []string
+	}{
+		{"regular", nil, []string{"2026-03-02 10:00", "2026-03-09 10:00", "2026-03-16 10:00", "2026-03-23 10:00"}},
+		{"cancelled", []ScheduleOverride{{Subject: testSubject, Date: "2026-03-09", Cancelled: true}},
+			[]string{"2026-03-02 10:00", "2026-03-16 10:00", "2026-03-23 10:00"}},
+		{"moved within", []ScheduleOverride{moved("2026-03-09", "2026-03-11 12:00")},
+			[]string{"2026-03-02 10:00", "2026-03-11 12:00", "2026-03-16 10:00", "2026-03-23 10:00"}},
+		{"moved out", []ScheduleOverride{moved("2026-03-23", "2026-04-01 10:00")},
+			[]string{"2026-03-02 10:00", "2026-03-09 10:00", "2026-03-16 10:00"}},
+		{"moved in from before", []ScheduleOverride{moved("2026-02-23", "2026-03-04 10:00")},
+			[]string{"2026-03-02 10:00", "2026-03-04 10:00", "2026-03-09 10:00", "2026-03-16 10:00", "2026-03-23 10:00"}},
+		{"moved in from after", []ScheduleOverride{moved("2026-04-20", "2026-03-25 10:00")},
+			[]string{"2026-03-02 10:00", "2026-03-09 10:00", "2026-03-16 10:00", "2026-03-23 10:00", "2026-03-25 10:00"}},
+		{"beyond the reschedule window", []ScheduleOverride{moved("2026-05-04", "2026-03-25 10:00")},
+			[]string{"2026-03-02 10:00", "2026-03-09 10:00", "2026-03-16 10:00", "2026-03-23 10:00"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subject.Overrides = make(map[string]ScheduleOverride)
+			for _, override := range tt.overrides {
+				subject.Overrides[override.Date] = override
+			}
+			if got := formatStarts(effectiveStarts(subject, from, until)); strings.Join(got, ", ") != strings.Join(tt.want, ", ") {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoveSessionKeepsState(t *testing.T) {
+	ns, _, _ := newTestService(t, 1, QueueMessageSeparate)
+	session := openSession(t, ns)
+	pressButton(ns, 0, "join_"+session.ID)
+
+	start := session.Start.AddDate(0, 0, 5)
+	moved, err := ns.queueManager.MoveSession(session.ID, start, session.End.AddDate(0, 0, 5), ns.registrationOpenTime(start), ns.registrationCloseTime(session.Subject, start))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ns.advanceSessions()
+	moved, _ = ns.queueManager.GetSession(moved.ID)
+	if moved.State != SessionOpen || len(moved.Queue) != 1 {
+		t.Fatalf("moved session is %s with %d students, want open with 1", moved.State, len(moved.Queue))
+	}
+
+	if err := ns.queueManager.SetSessionState(moved.ID, SessionClosed); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ns.queueManager.MoveSession(moved.ID, start.AddDate(0, 0, 1), moved.End.AddDate(0, 0, 1), moved.OpensAt, moved.ClosesAt); err == nil {
+		t.Error("a closed session was moved")
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var scheduleTimePattern = regexp.MustCompile(`^([01]?\d|2[0-3]):[0-5]\d$`)
+
+type ScheduleError struct {
+	Line    int
+	Message string
+}
+
+func (e ScheduleError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+}
+
+// ScheduleErrors collects every problem in a schedule file so they can be
+// fixed in one pass.
+type ScheduleErrors []ScheduleError
+
+func (e ScheduleErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+type scheduleRow struct {
+	line    int
+	subject Subject
+	day     time.Weekday
+	start   int
+	end     int
+}
+
+func parseScheduleMinutes(value string) (int, bool) {
+	value = strings.TrimSpace(value)
+	if !scheduleTimePattern.MatchString(value) {
+		return 0, false
+	}
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, false
+	}
+	return t.Hour()*60 + t.Minute(), true
+}
+
+// parseSubjects reads queue_lessons.txt strictly. knownSubject reports
+// whether a subject name has a sheet column.
+func parseSubjects(r io.Reader, knownSubject func(string) bool) ([]Subject, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	var errs ScheduleErrors
+	var rows []scheduleRow
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				errs = append(errs, ScheduleError{Line: parseErr.Line, Message: parseErr.Err.Error()})
+				continue
+			}
+			return nil, fmt.Errorf("error reading CSV: %w", err)
+		}
+
+		line, _ := reader.FieldPos(0)
+		addError := func(format string, args ...any) {
+			errs = append(errs, ScheduleError{Line: line, Message: fmt.Sprintf(format, args...)})
+		}
+
+		if len(record) < 4 || len(record) > 6 {
+			addError("expected 4 to 6 fields (day,start,subject,end[,policy[,capacity]]), got %d", len(record))
+			continue
+		}
+
+		subject := Subject{
+			Day:    strings.TrimSpace(record[0]),
+			Start:  strings.TrimSpace(record[1]),
+			Name:   strings.TrimSpace(record[2]),
+			End:    strings.TrimSpace(record[3]),
+			Policy: PolicyFIFO,
+		}
+		valid := true
+
+		day := parseWeekday(subject.Day)
+		if day == -1 {
+			addError("unknown weekday %q (expected пн, вт, ср, чт, пт, сб or вс)", subject.Day)
+			valid = false
+		}
+
+		start, startOK := parseScheduleMinutes(subject.Start)
+		if !startOK {
+			addError("invalid start time %q (expected HH:MM)", subject.Start)
+			valid = false
+		}
+		end, endOK := parseScheduleMinutes(subject.End)
+		if !endOK {
+			addError("invalid end time %q (expected HH:MM)", subject.End)
+			valid = false
+		}
+		if startOK && endOK && end <= start {
+			addError("end time %s is not after start time %s", subject.End, subject.Start)
+			valid = false
+		}
+
+		if subject.Name == "" {
+			addError("subject name is empty")
+			valid = false
+		} else if !knownSubject(subject.Name) {
+			addError("unknown subject %q: no short code / sheet column is configured for it", subject.Name)
+			valid = false
+		}
+
+		if len(record) >= 5 && strings.TrimSpace(record[4]) != "" {
+			subject.Policy = strings.ToLower(strings.TrimSpace(record[4]))
+			if !isKnownPolicy(subject.Policy) {
+				addError("unknown ordering policy %q", record[4])
+				valid = false
+			}
+		}
+		if len(record) == 6 && strings.TrimSpace(record[5]) != "" {
+			capacity, err := strconv.Atoi(strings.TrimSpace(record[5]))
+			if err != nil || capacity < 0 {
+				addError("invalid capacity %q (expected a non-negative number)", record[5])
+				valid = false
+			}
+			subject.Capacity = capacity
+		}
+
+		if valid {
+			rows = append(rows, scheduleRow{line: line, subject: subject, day: day, start: start, end: end})
+		}
+	}
+
+	for i, row := range rows {
+		for _, other := range rows[:i] {
+			if row.day == other.day && row.start < other.end && other.start < row.end {
+				errs = append(errs, ScheduleError{
+					Line:    row.line,
+					Message: fmt.Sprintf("%q overlaps %q on line %d", row.subject.Name, other.subject.Name, other.line),
+				})
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		sort.SliceStable(errs, func(i, j int) bool { return errs[i].Line < errs[j].Line })
+		return nil, errs
+	}
+
+	subjects := make([]Subject, len(rows))
+	for i, row := range rows {
+		subjects[i] = row.subject
+	}
+	return subjects, nil
+}
+
+func (qm *QueueManager) knownSubject(name string) bool {
+	_, exists := qm.GetColumnMapping(name)
+	return exists
+}
+
+// ValidateSubjects checks a schedule file without loading it.
+func (qm *QueueManager) ValidateSubjects(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("error opening %s: %w", filename, err)
+	}
+	defer file.Close()
+
+	_, err = parseSubjects(file, qm.knownSubject)
+	return err
+}
+
+// loadSchedule loads subjects from the .ics timetable when configured and
+// from the CSV schedule otherwise.
+func loadSchedule(qm *QueueManager, config *Config) error {
+	if config.ScheduleICSFile != "" {
+		return qm.LoadSubjectsFromICS(config.ScheduleICSFile, config.ScheduleMappingFile)
+	}
+	return qm.LoadSubjects(config.SubjectsFile)
+}
+
+func (ns *NotificationService) scheduleFile() string {
+	if ns.config.ScheduleICSFile != "" {
+		return ns.config.ScheduleICSFile
+	}
+	return ns.config.SubjectsFile
+}
+
+// reloadScheduleIfChanged re-reads the schedule after it is edited on disk.
+// An invalid file is rejected and the current schedule stays in place.
+func (ns *NotificationService) reloadScheduleIfChanged() {
+	filename := ns.scheduleFile()
+	info, err := os.Stat(filename)
+	if err != nil {
+		log.Printf("Error checking schedule file %s: %v", filename, err)
+		return
+	}
+
+	if !ns.state.scheduleChanged(info.ModTime()) {
+		return
+	}
+
+	if err := loadSchedule(ns.queueManager, ns.config); err != nil {
+		log.Printf("❌ Расписание %s не перезагружено, остаётся прежнее:\n%v", filename, err)
+		return
+	}
+	log.Printf("🔄 Расписание %s перезагружено", filename)
+	ns.scheduleUpcomingSessions()
+}
+
+// checkConfig implements --check-config: it validates the configuration and
+// the schedule it points to, reporting every error with its line number. A
+// file argument checks that CSV schedule instead of the configured one.
+func checkConfig(args []string) int {
+	config, err := readConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration\n%v\n", err)
+		return 1
+	}
+	setLocation(config.Location)
+
+	status := 0
+	if err := config.validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration\n%v\n", err)
+		status = 1
+	} else {
+		fmt.Println("configuration: OK")
+	}
+
+	if len(args) > 0 {
+		config.SubjectsFile = args[0]
+		config.ScheduleICSFile = ""
+	}
+
+	filename := config.SubjectsFile
+	queueManager := NewQueueManager()
+	if config.ScheduleICSFile != "" {
+		filename = config.ScheduleICSFile
+		err = queueManager.LoadSubjectsFromICS(config.ScheduleICSFile, config.ScheduleMappingFile)
+	} else {
+		err = queueManager.ValidateSubjects(config.SubjectsFile)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: invalid schedule\n%v\n", filename, err)
+		return 1
+	}
+	fmt.Printf("%s: OK\n", filename)
+	return status
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const maxSendRetries = 3
+
+// Sender is the bot's single way out to Telegram. It spaces requests to
+// stay under the global and per-chat limits, merges edits of the same
+// message that are still waiting for their turn, and retries requests
+// rejected with 429 after the delay Telegram asks for.
+type Sender struct {
+	bot            *tgbotapi.BotAPI
+	globalInterval time.Duration
+	chatInterval   time.Duration
+
+	mu           sync.Mutex
+	globalNext   time.Time
+	chatNext     map[int64]time.Time
+	pendingEdits map[string]*pendingEdit
+}
+
+type pendingEdit struct {
+	config  tgbotapi.Chattable
+	done    chan struct{}
+	message tgbotapi.Message
+	err     error
+}
+
+func NewSender(bot *tgbotapi.BotAPI, config *Config) *Sender {
+	return &Sender{
+		bot:            bot,
+		globalInterval: time.Second / time.Duration(config.SendRateGlobal),
+		chatInterval:   time.Minute / time.Duration(config.SendRateChat),
+		chatNext:       make(map[int64]time.Time),
+		pendingEdits:   make(map[string]*pendingEdit),
+	}
+}
+
+// chatOf returns the chat a request posts to, or false for requests that
+// do not add a message to a chat (callback answers, pins, lookups).
+func chatOf(c tgbotapi.Chattable) (int64, bool) {
+	switch c := c.(type) {
+	case tgbotapi.MessageConfig:
+		return c.ChatID, true
+	case tgbotapi.EditMessageTextConfig:
+		return c.ChatID, true
+	case tgbotapi.EditMessageReplyMarkupConfig:
+		return c.ChatID, true
+	case tgbotapi.DocumentConfig:
+		return c.ChatID, true
+	default:
+		return 0, false
+	}
+}
+
+func editKey(c tgbotapi.Chattable) (string, bool) {
+	edit, ok := c.(tgbotapi.EditMessageTextConfig)
+	if !ok || edit.InlineMessageID != "" {
+		return "", false
+	}
+	return fmt.Sprintf("%d/%d", edit.ChatID, edit.MessageID), true
+}
+
+// reserve books the next free slot for a request and returns when it is.
+// Private chats allow about one message per second, groups fewer.
+func (s *Sender) reserve(c tgbotapi.Chattable) time.Time {
+	at := time.Now()
+	if s.globalNext.After(at) {
+		at = s.globalNext
+	}
+	s.globalNext = at.Add(s.globalInterval)
+
+	chatID, ok := chatOf(c)
+	if !ok {
+		return at
+	}
+	if next := s.chatNext[chatID]; next.After(at) {
+		at = next
+	}
+	interval := s.chatInterval
+	if chatID > 0 {
+		interval = time.Second
+	}
+	s.chatNext[chatID] = at.Add(interval)
+	return at
+}
+
+// backOff keeps everything for the chat (and, for requests outside a chat,
+// everything at all) waiting until Telegram accepts requests again.
+func (s *Sender) backOff(c tgbotapi.Chattable, until time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if chatID, ok := chatOf(c); ok {
+		if s.chatNext[chatID].Before(until) {
+			s.chatNext[chatID] = until
+		}
+		return
+	}
+	if s.globalNext.Before(until) {
+		s.globalNext = until
+	}
+}
+
+func (s *Sender) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	key, isEdit := editKey(c)
+	if !isEdit {
+		s.mu.Lock()
+		at := s.reserve(c)
+		s.mu.Unlock()
+
+		time.Sleep(time.Until(at))
+		return s.sendWithRetry(c)
+	}
+
+	s.mu.Lock()
+	if pending, exists := s.pendingEdits[key]; exists {
+		// The earlier edit has not gone out yet: send this text instead
+		// and share its result.
+		pending.config = c
+		s.mu.Unlock()
+		<-pending.done
+		return pending.message, pending.err
+	}
+	pending := &pendingEdit{config: c, done: make(chan struct{})}
+	s.pendingEdits[key] = pending
+	at := s.reserve(c)
+	s.mu.Unlock()
+
+	time.Sleep(time.Until(at))
+
+	s.mu.Lock()
+	delete(s.pendingEdits, key)
+	c = pending.config
+	s.mu.Unlock()
+
+	pending.message, pending.err = s.sendWithRetry(c)
+	close(pending.done)
+	return pending.message, pending.err
+}
+
+func (s *Sender) sendWithRetry(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	var message tgbotapi.Message
+	err := s.withRetry(c, func() (err error) {
+		message, err = s.bot.Send(c)
+		return err
+	})
+	return message, err
+}
+
+// Request is used for calls that return no message, such as callback
+// answers and pins. They share the global limit and the 429 handling.
+func (s *Sender) Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error) {
+	s.mu.Lock()
+	at := s.reserve(c)
+	s.mu.Unlock()
+	time.Sleep(time.Until(at))
+
+	var response *tgbotapi.APIResponse
+	err := s.withRetry(c, func() (err error) {
+		response, err = s.bot.Request(c)
+		return err
+	})
+	return response, err
+}
+
+func (s *Sender) withRetry(c tgbotapi.Chattable, call func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := call()
+		retryAfter, limited := retryAfter(err)
+		if !limited || attempt > maxSendRetries {
+			return err
+		}
+
+		log.Printf("⏳ Telegram rate limit hit, retrying in %v (attempt %d/%d)", retryAfter, attempt, maxSendRetries)
+		s.backOff(c, time.Now().Add(retryAfter))
+		time.Sleep(retryAfter)
+	}
+}
+
+func (s *Sender) GetChatMember(config tgbotapi.GetChatMemberConfig) (tgbotapi.ChatMember, error) {
+	return s.bot.GetChatMember(config)
+}
+
+func retryAfter(err error) (time.Duration, bool) {
+	var apiErr *tgbotapi.Error
+	if !errors.As(err, &apiErr) || apiErr.RetryAfter <= 0 {
+		return 0, false
+	}
+	return time.Duration(apiErr.RetryAfter) * time.Second, true
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// serviceState is the bookkeeping shared by the scheduler goroutine and the
+// goroutines that handle updates. Its fields are only touched through the
+// methods below, each of which holds the lock for the whole check-and-set.
+type serviceState struct {
+	mu                sync.Mutex
+	sentNotifications map[string]time.Time
+	sentReminders     map[string]bool
+	scheduleModTime   time.Time
+}
+
+func newServiceState() *serviceState {
+	return &serviceState{
+		sentNotifications: make(map[string]time.Time),
+		sentReminders:     make(map[string]bool),
+	}
+}
+
+func (s *serviceState) notificationSentAt(sessionID string) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sentAt, exists := s.sentNotifications[sessionID]
+	return sentAt, exists
+}
+
+func (s *serviceState) recordNotification(sessionID string, sentAt time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sentNotifications[sessionID] = sentAt
+}
+
+func (s *serviceState) forgetNotificationsBefore(cutoff time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for sessionID, sentAt := range s.sentNotifications {
+		if sentAt.Before(cutoff) {
+			delete(s.sentNotifications, sessionID)
+		}
+	}
+}
+
+func reminderKey(sessionID string, userID int64) string {
+	return sessionID + "_" + strconv.FormatInt(userID, 10)
+}
+
+// claimReminder marks the turn reminder for a student as sent and reports
+// whether it had not been sent before.
+func (s *serviceState) claimReminder(sessionID string, userID int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := reminderKey(sessionID, userID)
+	if s.sentReminders[key] {
+		return false
+	}
+	s.sentReminders[key] = true
+	return true
+}
+
+func (s *serviceState) forgetReminders(sessionID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key := range s.sentReminders {
+		if strings.HasPrefix(key, sessionID+"_") {
+			delete(s.sentReminders, key)
+		}
+	}
+}
+
+// scheduleChanged records the schedule file's modification time and
+// reports whether it is newer than the one seen before. The first call
+// only remembers it.
+func (s *serviceState) scheduleChanged(modTime time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.scheduleModTime.IsZero() {
+		s.scheduleModTime = modTime
+		return false
+	}
+	if !modTime.After(s.scheduleModTime) {
+		return false
+	}
+	s.scheduleModTime = modTime
+	return true
+}
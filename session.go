@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+type SessionState string
+
+const (
+	SessionScheduled  SessionState = "scheduled"
+	SessionOpen       SessionState = "open"
+	SessionClosed     SessionState = "closed"
+	SessionInProgress SessionState = "in_progress"
+	SessionFinished   SessionState = "finished"
+)
+
+var sessionStateOrder = []SessionState{
+	SessionScheduled,
+	SessionOpen,
+	SessionClosed,
+	SessionInProgress,
+	SessionFinished,
+}
+
+func (s SessionState) rank() int {
+	for i, state := range sessionStateOrder {
+		if state == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// Next returns the state that follows s in the session lifecycle.
+func (s SessionState) Next() (SessionState, bool) {
+	rank := s.rank()
+	if rank < 0 || rank == len(sessionStateOrder)-1 {
+		return s, false
+	}
+	return sessionStateOrder[rank+1], true
+}
+
+// CanTransitionTo reports whether a session may move from s to next.
+// Sessions only move forward through the lifecycle.
+func (s SessionState) CanTransitionTo(next SessionState) bool {
+	from, to := s.rank(), next.rank()
+	return from >= 0 && to > from
+}
+
+type EntryStatus string
+
+const (
+	EntryWaiting   EntryStatus = ""
+	EntryCalled    EntryStatus = "called"
+	EntryPresented EntryStatus = "presented"
+	EntrySkipped   EntryStatus = "skipped"
+)
+
+type QueueEntry struct {
+	Name       string      `json:"name"`
+	Status     EntryStatus `json:"status,omitempty"`
+	Note       string      `json:"note,omitempty"`
+	JoinedAt   time.Time   `json:"joined_at"`
+	CalledAt   time.Time   `json:"called_at,omitzero"`
+	FinishedAt time.Time   `json:"finished_at,omitzero"`
+	LeftAt     time.Time   `json:"left_at,omitzero"`
+}
+
+// Session is a single occurrence of a subject together with its queue.
+type Session struct {
+	ID       string       `json:"id"`
+	Subject  Subject      `json:"subject"`
+	Start    time.Time    `json:"start"`
+	End      time.Time    `json:"end"`
+	OpensAt  time.Time    `json:"opens_at"`
+	ClosesAt time.Time    `json:"closes_at,omitzero"`
+	State    SessionState `json:"state"`
+	Queue    []QueueEntry `json:"queue"`
+	Waitlist []QueueEntry `json:"waitlist,omitempty"`
+	Departed []QueueEntry `json:"departed,omitempty"`
+
+	LotterySeed    int64     `json:"lottery_seed,omitempty"`
+	LotteryDrawnAt time.Time `json:"lottery_drawn_at,omitzero"`
+}
+
+func newSessionID(code string, start time.Time) string {
+	return fmt.Sprintf("%s_%s", code, start.Format("2006-01-02_1504"))
+}
+
+func (s *Session) RegistrationOpensAt() time.Time {
+	return s.OpensAt
+}
+
+func (s *Session) RegistrationClosesAt() time.Time {
+	if s.ClosesAt.IsZero() || s.ClosesAt.After(s.Start) {
+		return s.Start
+	}
+	return s.ClosesAt
+}
+
+// StateAt returns the state the session should be in at the given moment
+// according to its schedule.
+func (s *Session) StateAt(now time.Time) SessionState {
+	switch {
+	case !now.Before(s.End):
+		return SessionFinished
+	case !now.Before(s.Start):
+		return SessionInProgress
+	case !now.Before(s.RegistrationClosesAt()):
+		return SessionClosed
+	case !now.Before(s.RegistrationOpensAt()):
+		return SessionOpen
+	default:
+		return SessionScheduled
+	}
+}
+
+func (s *Session) AcceptsJoins() bool {
+	return s.State == SessionOpen || s.State == SessionInProgress
+}
+
+func (s *Session) Names() []string {
+	names := make([]string, len(s.Queue))
+	for i, entry := range s.Queue {
+		names[i] = entry.Name
+	}
+	return names
+}
+
+func (s *Session) position(realName string) int {
+	for i, entry := range s.Queue {
+		if entry.Name == realName {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *Session) waitlistPosition(realName string) int {
+	for i, entry := range s.Waitlist {
+		if entry.Name == realName {
+			return i
+		}
+	}
+	return -1
+}
+
+// IsFull reports whether new sign-ups should go to the waitlist. Lottery
+// sessions accept everyone until the draw.
+func (s *Session) IsFull() bool {
+	if s.Subject.Capacity <= 0 {
+		return false
+	}
+	if s.Subject.Policy == PolicyLottery && s.LotteryDrawnAt.IsZero() {
+		return false
+	}
+	return len(s.Queue) >= s.Subject.Capacity
+}
+
+func (s *Session) WaitlistNames() []string {
+	names := make([]string, len(s.Waitlist))
+	for i, entry := range s.Waitlist {
+		names[i] = entry.Name
+	}
+	return names
+}
+
+func (s *Session) current() int {
+	for i, entry := range s.Queue {
+		if entry.Status == EntryCalled {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *Session) nextWaiting() int {
+	for i, entry := range s.Queue {
+		if entry.Status == EntryWaiting {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *Session) depart(i int, at time.Time) {
+	entry := s.Queue[i]
+	entry.LeftAt = at
+	s.Departed = append(s.Departed, entry)
+	s.Queue = append(s.Queue[:i], s.Queue[i+1:]...)
+}
+
+func (s *Session) Notes() []string {
+	notes := make([]string, len(s.Queue))
+	for i, entry := range s.Queue {
+		notes[i] = entry.Note
+	}
+	return notes
+}
+
+func (s *Session) clone() Session {
+	c := *s
+	c.Queue = make([]QueueEntry, len(s.Queue))
+	copy(c.Queue, s.Queue)
+	c.Waitlist = make([]QueueEntry, len(s.Waitlist))
+	copy(c.Waitlist, s.Waitlist)
+	c.Departed = make([]QueueEntry, len(s.Departed))
+	copy(c.Departed, s.Departed)
+	return c
+}
@@ -6,19 +6,39 @@ import (
 	"log"
 	"os"
 	"strings"
+	"time"
 
 	"golang.org/x/oauth2/google"
 	"google.golang.org/api/option"
 	"google.golang.org/api/sheets/v4"
 )
 
+// QueueSheet is the shared spreadsheet the queues are mirrored to. The
+// Google Sheets implementation is SheetsService.
+type QueueSheet interface {
+	AddToSheet(subjectName, userName string) error
+	RemoveFromSheet(subjectName, userName string) error
+	ClearColumn(subjectName string) error
+	GetQueueFromSheet(subjectName string) ([]string, error)
+	WriteQueue(subjectName string, userNames, notes []string) error
+	SwapInSheet(subjectName, firstName, secondName string) error
+	GetWaitlistFromSheet(subjectName string) ([]string, error)
+	WriteWaitlist(subjectName string, userNames []string) error
+	GetNotesFromSheet(subjectName string) (map[string]string, error)
+	WriteNote(subjectName, userName, note string) error
+	ArchiveSession(session Session) error
+	WriteTable(title string, header []string, rows [][]string) error
+}
+
 type SheetsService struct {
 	service       *sheets.Service
 	spreadsheetID string
+	lastColumn    string
 	queueManager  *QueueManager
+	messages      *Messages
 }
 
-func NewSheetsService(config *Config, queueManager *QueueManager) (*SheetsService, error) {
+func NewSheetsService(config *Config, queueManager *QueueManager, messages *Messages) (*SheetsService, error) {
 	ctx := context.Background()
 
 	var creds []byte
@@ -50,12 +70,23 @@ func NewSheetsService(config *Config, queueManager *QueueManager) (*SheetsServic
 	return &SheetsService{
 		service:       service,
 		spreadsheetID: config.GoogleSheetsID,
+		lastColumn:    config.SheetsLastColumn,
 		queueManager:  queueManager,
+		messages:      messages,
 	}, nil
 }
 
+// dataRange is the whole used area of the queue sheet.
+func (ss *SheetsService) dataRange() string {
+	return "A1:" + ss.lastColumn
+}
+
+func (ss *SheetsService) headerRange() string {
+	return "A1:" + ss.lastColumn + "1"
+}
+
 func (ss *SheetsService) AddToSheet(subjectName, userName string) error {
-	readRange := "A:ZZ"
+	readRange := ss.dataRange()
 	resp, err := ss.service.Spreadsheets.Values.Get(ss.spreadsheetID, readRange).Do()
 	if err != nil {
 		return fmt.Errorf("unable to retrieve data from sheet: %w", err)
@@ -142,7 +173,7 @@ func (ss *SheetsService) ClearColumn(subjectName string) error {
 		return fmt.Errorf("subject not found in column mapping: %s", subjectName)
 	}
 
-	readRange := "A:ZZ"
+	readRange := ss.dataRange()
 	resp, err := ss.service.Spreadsheets.Values.Get(ss.spreadsheetID, readRange).Do()
 	if err != nil {
 		return fmt.Errorf("unable to retrieve data from sheet: %w", err)
@@ -169,7 +200,11 @@ func (ss *SheetsService) ClearColumn(subjectName string) error {
 	}
 
 	columnLetter := numberToColumnLetter(subjectColumn + 1)
-	clearRange := fmt.Sprintf("%s2:%s", columnLetter, columnLetter)
+	lastColumnLetter := columnLetter
+	if notesColumn, err := ss.notesColumn(subjectName, subjectColumn, false); err == nil && notesColumn != -1 {
+		lastColumnLetter = numberToColumnLetter(notesColumn + 1)
+	}
+	clearRange := fmt.Sprintf("%s2:%s", columnLetter, lastColumnLetter)
 
 	_, err = ss.service.Spreadsheets.Values.Clear(ss.spreadsheetID, clearRange, &sheets.ClearValuesRequest{}).Do()
 	if err != nil {
@@ -189,7 +224,7 @@ func (ss *SheetsService) RemoveFromSheet(subjectName, userName string) error {
 
 	log.Printf("🔍 Ищем колонку: %s", columnName)
 
-	resp, err := ss.service.Spreadsheets.Values.Get(ss.spreadsheetID, "A1:Z").Do()
+	resp, err := ss.service.Spreadsheets.Values.Get(ss.spreadsheetID, ss.dataRange()).Do()
 	if err != nil {
 		return fmt.Errorf("unable to retrieve data from sheet: %w", err)
 	}
@@ -240,6 +275,9 @@ func (ss *SheetsService) RemoveFromSheet(subjectName, userName string) error {
 
 	columnLetter := numberToColumnLetter(subjectColumn + 1)
 	clearRange := fmt.Sprintf("%s%d", columnLetter, targetRow)
+	if notesColumn, err := ss.notesColumn(subjectName, subjectColumn, false); err == nil && notesColumn != -1 {
+		clearRange = fmt.Sprintf("%s%d:%s%d", columnLetter, targetRow, numberToColumnLetter(notesColumn+1), targetRow)
+	}
 	log.Printf("🗑️  Очищаем ячейку: %s", clearRange)
 
 	_, err = ss.service.Spreadsheets.Values.Clear(ss.spreadsheetID, clearRange, &sheets.ClearValuesRequest{}).Do()
@@ -254,7 +292,7 @@ func (ss *SheetsService) RemoveFromSheet(subjectName, userName string) error {
 func (ss *SheetsService) RestoreColumnHeaders() error {
 	log.Println("🔧 Проверяем и восстанавливаем заголовки столбцов...")
 
-	resp, err := ss.service.Spreadsheets.Values.Get(ss.spreadsheetID, "A1:Z1").Do()
+	resp, err := ss.service.Spreadsheets.Values.Get(ss.spreadsheetID, ss.headerRange()).Do()
 	if err != nil {
 		return fmt.Errorf("unable to retrieve headers from sheet: %w", err)
 	}
@@ -340,7 +378,7 @@ func (ss *SheetsService) GetQueueFromSheet(subjectName string) ([]string, error)
 		return nil, fmt.Errorf("no column mapping for subject: %s", subjectName)
 	}
 
-	resp, err := ss.service.Spreadsheets.Values.Get(ss.spreadsheetID, "A1:Z").Do()
+	resp, err := ss.service.Spreadsheets.Values.Get(ss.spreadsheetID, ss.dataRange()).Do()
 	if err != nil {
 		return nil, fmt.Errorf("unable to retrieve data from sheet: %w", err)
 	}
@@ -378,3 +416,493 @@ func (ss *SheetsService) GetQueueFromSheet(subjectName string) ([]string, error)
 	log.Printf("📋 Очередь из Google Sheets для '%s': %v", subjectName, queue)
 	return queue, nil
 }
+
+func (ss *SheetsService) ensureSheet(title string, header []interface{}) error {
+	spreadsheet, err := ss.service.Spreadsheets.Get(ss.spreadsheetID).Fields("sheets.properties.title").Do()
+	if err != nil {
+		return fmt.Errorf("unable to retrieve spreadsheet: %w", err)
+	}
+
+	for _, sheet := range spreadsheet.Sheets {
+		if sheet.Properties != nil && sheet.Properties.Title == title {
+			return nil
+		}
+	}
+
+	request := &sheets.BatchUpdateSpreadsheetRequest{
+		Requests: []*sheets.Request{
+			{AddSheet: &sheets.AddSheetRequest{Properties: &sheets.SheetProperties{Title: title}}},
+		},
+	}
+	if _, err := ss.service.Spreadsheets.BatchUpdate(ss.spreadsheetID, request).Do(); err != nil {
+		return fmt.Errorf("unable to create sheet %s: %w", title, err)
+	}
+
+	if len(header) > 0 {
+		valueRange := &sheets.ValueRange{Values: [][]interface{}{header}}
+		_, err = ss.service.Spreadsheets.Values.Update(ss.spreadsheetID, fmt.Sprintf("'%s'!A1", title), valueRange).
+			ValueInputOption("RAW").Do()
+		if err != nil {
+			return fmt.Errorf("unable to write header to sheet %s: %w", title, err)
+		}
+	}
+
+	log.Printf("📄 Создан лист '%s'", title)
+	return nil
+}
+
+func (ss *SheetsService) ArchiveSession(session Session) error {
+	archiveTitle := ss.messages.Plain("sheets.archive", nil)
+	var header []interface{}
+	for _, column := range []string{"date", "subject", "position", "student", "joined_at", "left_at", "status", "note"} {
+		header = append(header, ss.messages.Plain("column."+column, nil))
+	}
+	if err := ss.ensureSheet(archiveTitle, header); err != nil {
+		return err
+	}
+
+	date := session.Start.In(getLocation()).Format("2006-01-02 15:04")
+	var values [][]interface{}
+	for i, entry := range session.Queue {
+		values = append(values, []interface{}{
+			date, session.Subject.Name, i + 1, entry.Name, formatSheetTime(entry.JoinedAt), "", ss.messages.entryStatusLabel(entry.Status), entry.Note,
+		})
+	}
+	for _, entry := range session.Waitlist {
+		values = append(values, []interface{}{
+			date, session.Subject.Name, "", entry.Name, formatSheetTime(entry.JoinedAt), "", ss.messages.Plain("status.waitlisted", nil), entry.Note,
+		})
+	}
+	for _, entry := range session.Departed {
+		values = append(values, []interface{}{
+			date, session.Subject.Name, "", entry.Name, formatSheetTime(entry.JoinedAt), formatSheetTime(entry.LeftAt), ss.messages.Plain("status.left", nil), entry.Note,
+		})
+	}
+
+	if len(values) == 0 {
+		return nil
+	}
+
+	valueRange := &sheets.ValueRange{Values: values}
+	_, err := ss.service.Spreadsheets.Values.Append(ss.spreadsheetID, fmt.Sprintf("'%s'!A:H", archiveTitle), valueRange).
+		ValueInputOption("RAW").InsertDataOption("INSERT_ROWS").Do()
+	if err != nil {
+		return fmt.Errorf("unable to append archive rows: %w", err)
+	}
+
+	log.Printf("🗄️  Сессия %s записана на лист '%s' (%d строк)", session.ID, archiveTitle, len(values))
+	return nil
+}
+
+func formatSheetTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.In(getLocation()).Format("2006-01-02 15:04:05")
+}
+
+func (ss *SheetsService) findSubjectColumn(subjectName string) (int, error) {
+	columnName, exists := ss.queueManager.GetColumnMapping(subjectName)
+	if !exists {
+		return -1, fmt.Errorf("no column mapping for subject: %s", subjectName)
+	}
+
+	resp, err := ss.service.Spreadsheets.Values.Get(ss.spreadsheetID, ss.headerRange()).Do()
+	if err != nil {
+		return -1, fmt.Errorf("unable to retrieve headers from sheet: %w", err)
+	}
+
+	if len(resp.Values) == 0 {
+		return -1, fmt.Errorf("no headers found in sheet")
+	}
+
+	for i, header := range resp.Values[0] {
+		if headerStr, ok := header.(string); ok {
+			if strings.Contains(headerStr, columnName) && len(headerStr) <= 20 {
+				return i, nil
+			}
+		}
+	}
+
+	return -1, fmt.Errorf("subject column not found: %s", columnName)
+}
+
+func (ss *SheetsService) WriteQueue(subjectName string, userNames, notes []string) error {
+	subjectColumn, err := ss.findSubjectColumn(subjectName)
+	if err != nil {
+		return err
+	}
+
+	hasNotes := false
+	for _, note := range notes {
+		if note != "" {
+			hasNotes = true
+			break
+		}
+	}
+
+	lastColumn := subjectColumn
+	notesColumn, err := ss.notesColumn(subjectName, subjectColumn, hasNotes)
+	if err != nil {
+		return err
+	}
+	if notesColumn != -1 {
+		lastColumn = notesColumn
+	}
+
+	columnLetter := numberToColumnLetter(subjectColumn + 1)
+	lastColumnLetter := numberToColumnLetter(lastColumn + 1)
+	clearRange := fmt.Sprintf("%s2:%s", columnLetter, lastColumnLetter)
+	if _, err := ss.service.Spreadsheets.Values.Clear(ss.spreadsheetID, clearRange, &sheets.ClearValuesRequest{}).Do(); err != nil {
+		return fmt.Errorf("unable to clear column in sheet: %w", err)
+	}
+
+	if len(userNames) == 0 {
+		return nil
+	}
+
+	values := make([][]interface{}, len(userNames))
+	for i, userName := range userNames {
+		values[i] = []interface{}{userName}
+		if notesColumn != -1 {
+			note := ""
+			if i < len(notes) {
+				note = notes[i]
+			}
+			values[i] = append(values[i], note)
+		}
+	}
+
+	writeRange := fmt.Sprintf("%s2:%s%d", columnLetter, lastColumnLetter, len(userNames)+1)
+	_, err = ss.service.Spreadsheets.Values.Update(ss.spreadsheetID, writeRange, &sheets.ValueRange{Values: values}).
+		ValueInputOption("RAW").Do()
+	if err != nil {
+		return fmt.Errorf("unable to write queue to sheet: %w", err)
+	}
+
+	log.Printf("📝 Очередь для %s записана в столбец %s: %v", subjectName, columnLetter, userNames)
+	return nil
+}
+
+func (ss *SheetsService) waitlistTitle() string {
+	return ss.messages.Plain("sheets.waitlist", nil)
+}
+
+func (ss *SheetsService) waitlistColumn(subjectName string) (string, error) {
+	columnName, exists := ss.queueManager.GetColumnMapping(subjectName)
+	if !exists {
+		return "", fmt.Errorf("no column mapping for subject: %s", subjectName)
+	}
+
+	if err := ss.ensureSheet(ss.waitlistTitle(), nil); err != nil {
+		return "", err
+	}
+
+	headerRange := fmt.Sprintf("'%s'!%s", ss.waitlistTitle(), ss.headerRange())
+	resp, err := ss.service.Spreadsheets.Values.Get(ss.spreadsheetID, headerRange).Do()
+	if err != nil {
+		return "", fmt.Errorf("unable to retrieve waitlist headers: %w", err)
+	}
+
+	var headers []interface{}
+	if len(resp.Values) > 0 {
+		headers = resp.Values[0]
+	}
+
+	for i, header := range headers {
+		if headerStr, ok := header.(string); ok && strings.TrimSpace(headerStr) == columnName {
+			return numberToColumnLetter(i + 1), nil
+		}
+	}
+
+	columnLetter := numberToColumnLetter(len(headers) + 1)
+	writeRange := fmt.Sprintf("'%s'!%s1", ss.waitlistTitle(), columnLetter)
+	_, err = ss.service.Spreadsheets.Values.Update(ss.spreadsheetID, writeRange,
+		&sheets.ValueRange{Values: [][]interface{}{{columnName}}}).ValueInputOption("RAW").Do()
+	if err != nil {
+		return "", fmt.Errorf("unable to add waitlist header for %s: %w", columnName, err)
+	}
+
+	return columnLetter, nil
+}
+
+func (ss *SheetsService) GetWaitlistFromSheet(subjectName string) ([]string, error) {
+	columnLetter, err := ss.waitlistColumn(subjectName)
+	if err != nil {
+		return nil, err
+	}
+
+	readRange := fmt.Sprintf("'%s'!%s2:%s", ss.waitlistTitle(), columnLetter, columnLetter)
+	resp, err := ss.service.Spreadsheets.Values.Get(ss.spreadsheetID, readRange).Do()
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve waitlist from sheet: %w", err)
+	}
+
+	var waitlist []string
+	for _, row := range resp.Values {
+		if len(row) > 0 && row[0] != nil {
+			if cellValue := strings.TrimSpace(fmt.Sprintf("%v", row[0])); cellValue != "" {
+				waitlist = append(waitlist, cellValue)
+			}
+		}
+	}
+	return waitlist, nil
+}
+
+func (ss *SheetsService) WriteWaitlist(subjectName string, userNames []string) error {
+	columnLetter, err := ss.waitlistColumn(subjectName)
+	if err != nil {
+		return err
+	}
+
+	clearRange := fmt.Sprintf("'%s'!%s2:%s", ss.waitlistTitle(), columnLetter, columnLetter)
+	if _, err := ss.service.Spreadsheets.Values.Clear(ss.spreadsheetID, clearRange, &sheets.ClearValuesRequest{}).Do(); err != nil {
+		return fmt.Errorf("unable to clear waitlist column: %w", err)
+	}
+
+	if len(userNames) == 0 {
+		return nil
+	}
+
+	values := make([][]interface{}, len(userNames))
+	for i, userName := range userNames {
+		values[i] = []interface{}{userName}
+	}
+
+	writeRange := fmt.Sprintf("'%s'!%s2:%s%d", ss.waitlistTitle(), columnLetter, columnLetter, len(userNames)+1)
+	_, err = ss.service.Spreadsheets.Values.Update(ss.spreadsheetID, writeRange, &sheets.ValueRange{Values: values}).
+		ValueInputOption("RAW").Do()
+	if err != nil {
+		return fmt.Errorf("unable to write waitlist to sheet: %w", err)
+	}
+	return nil
+}
+
+// SwapInSheet exchanges two cells of a subject column in a single batch
+// update so the sheet never shows a half-finished swap.
+func (ss *SheetsService) SwapInSheet(subjectName, firstName, secondName string) error {
+	subjectColumn, err := ss.findSubjectColumn(subjectName)
+	if err != nil {
+		return err
+	}
+
+	notesColumn, err := ss.notesColumn(subjectName, subjectColumn, false)
+	if err != nil {
+		return err
+	}
+
+	columnLetter := numberToColumnLetter(subjectColumn + 1)
+	lastColumnLetter := columnLetter
+	if notesColumn != -1 {
+		lastColumnLetter = numberToColumnLetter(notesColumn + 1)
+	}
+	readRange := fmt.Sprintf("%s2:%s", columnLetter, lastColumnLetter)
+	resp, err := ss.service.Spreadsheets.Values.Get(ss.spreadsheetID, readRange).Do()
+	if err != nil {
+		return fmt.Errorf("unable to retrieve data from sheet: %w", err)
+	}
+
+	firstRow, secondRow := -1, -1
+	for i, row := range resp.Values {
+		if len(row) == 0 || row[0] == nil {
+			continue
+		}
+		cellValue := strings.TrimSpace(fmt.Sprintf("%v", row[0]))
+		if cellValue == firstName && firstRow == -1 {
+			firstRow = i + 2
+		} else if cellValue == secondName && secondRow == -1 {
+			secondRow = i + 2
+		}
+	}
+
+	if firstRow == -1 || secondRow == -1 {
+		return fmt.Errorf("users %s and %s not both found in column %s", firstName, secondName, columnLetter)
+	}
+
+	firstValues := resp.Values[firstRow-2]
+	secondValues := resp.Values[secondRow-2]
+	if notesColumn != -1 {
+		firstValues = padRow(firstValues, 2)
+		secondValues = padRow(secondValues, 2)
+	}
+
+	request := &sheets.BatchUpdateValuesRequest{
+		ValueInputOption: "RAW",
+		Data: []*sheets.ValueRange{
+			{Range: fmt.Sprintf("%s%d:%s%d", columnLetter, firstRow, lastColumnLetter, firstRow), Values: [][]interface{}{secondValues}},
+			{Range: fmt.Sprintf("%s%d:%s%d", columnLetter, secondRow, lastColumnLetter, secondRow), Values: [][]interface{}{firstValues}},
+		},
+	}
+	if _, err := ss.service.Spreadsheets.Values.BatchUpdate(ss.spreadsheetID, request).Do(); err != nil {
+		return fmt.Errorf("unable to swap cells in sheet: %w", err)
+	}
+
+	log.Printf("🔄 В таблице поменяны местами %s (строка %d) и %s (строка %d)", firstName, firstRow, secondName, secondRow)
+	return nil
+}
+
+func padRow(row []interface{}, width int) []interface{} {
+	for len(row) < width {
+		row = append(row, "")
+	}
+	return row
+}
+
+func notesHeader(columnName string) string {
+	return columnName + " 📝"
+}
+
+// notesColumn returns the index of the notes column that sits right after
+// the subject column, inserting it when create is set. It returns -1 when
+// the column does not exist and create is not set.
+func (ss *SheetsService) notesColumn(subjectName string, subjectColumn int, create bool) (int, error) {
+	columnName, exists := ss.queueManager.GetColumnMapping(subjectName)
+	if !exists {
+		return -1, fmt.Errorf("no column mapping for subject: %s", subjectName)
+	}
+
+	resp, err := ss.service.Spreadsheets.Values.Get(ss.spreadsheetID, ss.headerRange()).Do()
+	if err != nil {
+		return -1, fmt.Errorf("unable to retrieve headers from sheet: %w", err)
+	}
+
+	notesColumn := subjectColumn + 1
+	if len(resp.Values) > 0 && notesColumn < len(resp.Values[0]) {
+		if headerStr, ok := resp.Values[0][notesColumn].(string); ok && strings.TrimSpace(headerStr) == notesHeader(columnName) {
+			return notesColumn, nil
+		}
+	}
+
+	if !create {
+		return -1, nil
+	}
+
+	spreadsheet, err := ss.service.Spreadsheets.Get(ss.spreadsheetID).Fields("sheets.properties.sheetId").Do()
+	if err != nil {
+		return -1, fmt.Errorf("unable to retrieve spreadsheet: %w", err)
+	}
+	if len(spreadsheet.Sheets) == 0 || spreadsheet.Sheets[0].Properties == nil {
+		return -1, fmt.Errorf("spreadsheet has no sheets")
+	}
+
+	request := &sheets.BatchUpdateSpreadsheetRequest{
+		Requests: []*sheets.Request{
+			{InsertDimension: &sheets.InsertDimensionRequest{
+				Range: &sheets.DimensionRange{
+					SheetId:    spreadsheet.Sheets[0].Properties.SheetId,
+					Dimension:  "COLUMNS",
+					StartIndex: int64(notesColumn),
+					EndIndex:   int64(notesColumn + 1),
+				},
+			}},
+		},
+	}
+	if _, err := ss.service.Spreadsheets.BatchUpdate(ss.spreadsheetID, request).Do(); err != nil {
+		return -1, fmt.Errorf("unable to insert notes column: %w", err)
+	}
+
+	writeRange := fmt.Sprintf("%s1", numberToColumnLetter(notesColumn+1))
+	_, err = ss.service.Spreadsheets.Values.Update(ss.spreadsheetID, writeRange,
+		&sheets.ValueRange{Values: [][]interface{}{{notesHeader(columnName)}}}).ValueInputOption("RAW").Do()
+	if err != nil {
+		return -1, fmt.Errorf("unable to write notes header: %w", err)
+	}
+
+	log.Printf("📝 Добавлен столбец заметок для %s", columnName)
+	return notesColumn, nil
+}
+
+func (ss *SheetsService) WriteNote(subjectName, userName, note string) error {
+	subjectColumn, err := ss.findSubjectColumn(subjectName)
+	if err != nil {
+		return err
+	}
+
+	notesColumn, err := ss.notesColumn(subjectName, subjectColumn, note != "")
+	if err != nil || notesColumn == -1 {
+		return err
+	}
+
+	columnLetter := numberToColumnLetter(subjectColumn + 1)
+	resp, err := ss.service.Spreadsheets.Values.Get(ss.spreadsheetID, fmt.Sprintf("%s2:%s", columnLetter, columnLetter)).Do()
+	if err != nil {
+		return fmt.Errorf("unable to retrieve data from sheet: %w", err)
+	}
+
+	targetRow := -1
+	for i, row := range resp.Values {
+		if len(row) > 0 && row[0] != nil && strings.TrimSpace(fmt.Sprintf("%v", row[0])) == userName {
+			targetRow = i + 2
+			break
+		}
+	}
+	if targetRow == -1 {
+		return fmt.Errorf("user %s not found in queue for %s", userName, subjectName)
+	}
+
+	writeRange := fmt.Sprintf("%s%d", numberToColumnLetter(notesColumn+1), targetRow)
+	_, err = ss.service.Spreadsheets.Values.Update(ss.spreadsheetID, writeRange,
+		&sheets.ValueRange{Values: [][]interface{}{{note}}}).ValueInputOption("RAW").Do()
+	if err != nil {
+		return fmt.Errorf("unable to write note to sheet: %w", err)
+	}
+	return nil
+}
+
+func (ss *SheetsService) GetNotesFromSheet(subjectName string) (map[string]string, error) {
+	subjectColumn, err := ss.findSubjectColumn(subjectName)
+	if err != nil {
+		return nil, err
+	}
+
+	notesColumn, err := ss.notesColumn(subjectName, subjectColumn, false)
+	if err != nil || notesColumn == -1 {
+		return nil, err
+	}
+
+	readRange := fmt.Sprintf("%s2:%s", numberToColumnLetter(subjectColumn+1), numberToColumnLetter(notesColumn+1))
+	resp, err := ss.service.Spreadsheets.Values.Get(ss.spreadsheetID, readRange).Do()
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve notes from sheet: %w", err)
+	}
+
+	notes := make(map[string]string)
+	for _, row := range resp.Values {
+		if len(row) < 2 || row[0] == nil || row[1] == nil {
+			continue
+		}
+		userName := strings.TrimSpace(fmt.Sprintf("%v", row[0]))
+		note := strings.TrimSpace(fmt.Sprintf("%v", row[1]))
+		if userName != "" && note != "" {
+			notes[userName] = note
+		}
+	}
+	return notes, nil
+}
+
+// WriteTable replaces the contents of a whole tab with the given table.
+func (ss *SheetsService) WriteTable(title string, header []string, rows [][]string) error {
+	if err := ss.ensureSheet(title, nil); err != nil {
+		return err
+	}
+
+	if _, err := ss.service.Spreadsheets.Values.Clear(ss.spreadsheetID, fmt.Sprintf("'%s'", title), &sheets.ClearValuesRequest{}).Do(); err != nil {
+		return fmt.Errorf("unable to clear sheet %s: %w", title, err)
+	}
+
+	values := make([][]interface{}, 0, len(rows)+1)
+	for _, row := range append([][]string{header}, rows...) {
+		cells := make([]interface{}, len(row))
+		for i, cell := range row {
+			cells[i] = cell
+		}
+		values = append(values, cells)
+	}
+
+	_, err := ss.service.Spreadsheets.Values.Update(ss.spreadsheetID, fmt.Sprintf("'%s'!A1", title), &sheets.ValueRange{Values: values}).
+		ValueInputOption("RAW").Do()
+	if err != nil {
+		return fmt.Errorf("unable to write sheet %s: %w", title, err)
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// LotteryResult is a drawn lottery, kept until its session is archived so
+// that a restart reuses it instead of drawing again.
+type LotteryResult struct {
+	Seed     int64     `json:"seed"`
+	DrawnAt  time.Time `json:"drawn_at"`
+	Queue    []string  `json:"queue"`
+	Waitlist []string  `json:"waitlist,omitempty"`
+}
+
+// ActiveSession is a session whose queue is in the sheet column, kept so that
+// a class ending while the bot is down is still archived and cleared.
+type ActiveSession struct {
+	ID       string    `json:"id"`
+	Subject  Subject   `json:"subject"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	OpensAt  time.Time `json:"opens_at"`
+	ClosesAt time.Time `json:"closes_at"`
+}
+
+type persistedState struct {
+	Lotteries      map[string]LotteryResult `json:"lotteries"`
+	ActiveSessions map[string]ActiveSession `json:"active_sessions,omitempty"`
+	// CalendarTokens maps personal calendar feed tokens to students.
+	CalendarTokens map[string]string `json:"calendar_tokens,omitempty"`
+	WeeklySummary  string            `json:"weekly_summary,omitempty"`
+}
+
+// StateStore keeps the bits of scheduler state that must survive a restart.
+type StateStore struct {
+	mu       sync.Mutex
+	filename string
+	state    persistedState
+}
+
+func NewStateStore(filename string) (*StateStore, error) {
+	ss := &StateStore{filename: filename}
+
+	if err := loadJSONFile(filename, &ss.state); err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("error loading state from %s: %w", filename, err)
+		}
+		log.Printf("State file %s not found, starting with empty state", filename)
+	}
+	if ss.state.Lotteries == nil {
+		ss.state.Lotteries = make(map[string]LotteryResult)
+	}
+	if ss.state.ActiveSessions == nil {
+		ss.state.ActiveSessions = make(map[string]ActiveSession)
+	}
+	if ss.state.CalendarTokens == nil {
+		ss.state.CalendarTokens = make(map[string]string)
+	}
+
+	log.Printf("Loaded %d drawn lotteries", len(ss.state.Lotteries))
+	return ss, nil
+}
+
+func (ss *StateStore) save() error {
+	if err := saveJSONFile(ss.filename, ss.state); err != nil {
+		return fmt.Errorf("error saving state to %s: %w", ss.filename, err)
+	}
+	return nil
+}
+
+func (ss *StateStore) Lottery(sessionID string) (LotteryResult, bool) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	result, exists := ss.state.Lotteries[sessionID]
+	return result, exists
+}
+
+func (ss *StateStore) SaveLottery(sessionID string, result LotteryResult) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	ss.state.Lotteries[sessionID] = result
+	return ss.save()
+}
+
+func (ss *StateStore) ForgetLottery(sessionID string) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	if _, exists := ss.state.Lotteries[sessionID]; !exists {
+		return nil
+	}
+	delete(ss.state.Lotteries, sessionID)
+	return ss.save()
+}
+
+// CalendarToken returns the personal calendar feed token of a student,
+// creating one on first use.
+func (ss *StateStore) CalendarToken(realName string) (string, error) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	for token, owner := range ss.state.CalendarTokens {
+		if owner == realName {
+			return token, nil
+		}
+	}
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("error generating calendar token: %w", err)
+	}
+	token := hex.EncodeToString(buf)
+	ss.state.CalendarTokens[token] = realName
+	if err := ss.save(); err != nil {
+		delete(ss.state.CalendarTokens, token)
+		return "", err
+	}
+	return token, nil
+}
+
+func (ss *StateStore) CalendarOwner(token string) (string, bool) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	realName, exists := ss.state.CalendarTokens[token]
+	return realName, exists
+}
+
+// ClaimWeeklySummary reports whether the summary for weekKey is still to be
+// sent and marks it as sent. The claim holds even if saving it fails.
+func (ss *StateStore) ClaimWeeklySummary(weekKey string) (bool, error) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	if ss.state.WeeklySummary == weekKey {
+		return false, nil
+	}
+	ss.state.WeeklySummary = weekKey
+	return true, ss.save()
+}
+
+func (ss *StateStore) ActiveSessions() []ActiveSession {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	sessions := make([]ActiveSession, 0, len(ss.state.ActiveSessions))
+	for _, session := range ss.state.ActiveSessions {
+		sessions = append(sessions, session)
+	}
+	return sessions
+}
+
+func (ss *StateStore) SaveActiveSession(session Session) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	ss.state.ActiveSessions[session.ID] = ActiveSession{
+		ID:       session.ID,
+		Subject:  session.Subject,
+		Start:    session.Start,
+		End:      session.End,
+		OpensAt:  session.OpensAt,
+		ClosesAt: session.ClosesAt,
+	}
+	return ss.save()
+}
+
+func (ss *StateStore) ForgetActiveSession(sessionID string) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	if _, exists := ss.state.ActiveSessions[sessionID]; !exists {
+		return nil
+	}
+	delete(ss.state.ActiveSessions, sessionID)
+	return ss.save()
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestWeeklySummaryClaimSurvivesRestart(t *testing.T) {
+	store, err := NewStateStore(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var summaries int64
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			claimed, err := store.ClaimWeeklySummary("2026-10")
+			if err != nil {
+				t.Error(err)
+			}
+			if claimed {
+				atomic.AddInt64(&summaries, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if summaries != 1 {
+		t.Errorf("weekly summary claimed %d times, want 1", summaries)
+	}
+
+	restarted, err := NewStateStore(store.filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claimed, _ := restarted.ClaimWeeklySummary("2026-10"); claimed {
+		t.Error("weekly summary claimed again after a restart")
+	}
+	if claimed, _ := restarted.ClaimWeeklySummary("2026-11"); !claimed {
+		t.Error("next week's summary not claimable")
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	weeklySummaryDay  = time.Sunday
+	weeklySummaryHour = 20
+	topStudentsCount  = 3
+)
+
+type StudentActivity struct {
+	Name     string
+	Sessions int
+}
+
+type SubjectStats struct {
+	SubjectName       string
+	Sessions          int
+	AverageQueueLen   float64
+	AverageWaitPos    float64
+	HasWaitPos        bool
+	NoShowRate        float64
+	HasNoShowRate     bool
+	MostActive        []StudentActivity
+	TotalParticipants int
+}
+
+func computeSubjectStats(subjectName string, sessions []ArchivedSession) SubjectStats {
+	stats := SubjectStats{SubjectName: subjectName, Sessions: len(sessions)}
+	if len(sessions) == 0 {
+		return stats
+	}
+
+	activity := make(map[string]int)
+	totalQueueLen := 0
+	presentedPositions, presentedCount := 0, 0
+	calledCount, skippedCount := 0, 0
+
+	for _, session := range sessions {
+		totalQueueLen += len(session.Queue)
+		for i, entry := range session.Queue {
+			activity[entry.Name]++
+			switch entry.Status {
+			case EntryPresented:
+				presentedPositions += i + 1
+				presentedCount++
+				calledCount++
+			case EntrySkipped:
+				skippedCount++
+				calledCount++
+			}
+		}
+	}
+
+	stats.AverageQueueLen = float64(totalQueueLen) / float64(len(sessions))
+	if presentedCount > 0 {
+		stats.AverageWaitPos = float64(presentedPositions) / float64(presentedCount)
+		stats.HasWaitPos = true
+	}
+	if calledCount > 0 {
+		stats.NoShowRate = float64(skippedCount) / float64(calledCount)
+		stats.HasNoShowRate = true
+	}
+
+	for name, count := range activity {
+		stats.MostActive = append(stats.MostActive, StudentActivity{Name: name, Sessions: count})
+	}
+	stats.TotalParticipants = len(stats.MostActive)
+	sort.Slice(stats.MostActive, func(i, j int) bool {
+		if stats.MostActive[i].Sessions != stats.MostActive[j].Sessions {
+			return stats.MostActive[i].Sessions > stats.MostActive[j].Sessions
+		}
+		return stats.MostActive[i].Name < stats.MostActive[j].Name
+	})
+	if len(stats.MostActive) > topStudentsCount {
+		stats.MostActive = stats.MostActive[:topStudentsCount]
+	}
+
+	return stats
+}
+
+func (ns *NotificationService) buildStatsReport(subjectNames []string, from, to time.Time) string {
+	var text string
+	for _, subjectName := range subjectNames {
+		sessions := filterArchivedSessions(ns.historyStore.GetSessions(subjectName), from, to)
+		if len(sessions) == 0 {
+			continue
+		}
+		text += ns.t("stats.subject", computeSubjectStats(subjectName, sessions)) + "\n"
+	}
+	return strings.TrimSpace(text)
+}
+
+func (ns *NotificationService) subjectNames() []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, subject := range ns.queueManager.GetSubjects() {
+		if !seen[subject.Name] {
+			seen[subject.Name] = true
+			names = append(names, subject.Name)
+		}
+	}
+	return names
+}
+
+func (ns *NotificationService) handleStatsCommand(message *tgbotapi.Message) {
+	subjectNames := ns.subjectNames()
+	if arg := strings.TrimSpace(message.CommandArguments()); arg != "" {
+		subjectName := ns.findSubjectByShortCode(arg)
+		if subjectName == "" {
+			ns.reply(message, ns.t("common.subject_not_found", vars{"Code": arg}))
+			return
+		}
+		subjectNames = []string{subjectName}
+	}
+
+	report := ns.buildStatsReport(subjectNames, time.Time{}, time.Time{})
+	if report == "" {
+		ns.reply(message, ns.t("stats.empty", nil))
+		return
+	}
+	ns.reply(message, ns.t("stats.header", nil)+"\n\n"+report)
+}
+
+func (ns *NotificationService) checkWeeklySummary() {
+	now := getLocalTime()
+	if now.Weekday() != weeklySummaryDay || now.Hour() != weeklySummaryHour {
+		return
+	}
+
+	year, week := now.ISOWeek()
+	weekKey := fmt.Sprintf("%d-%02d", year, week)
+	claimed, err := ns.stateStore.ClaimWeeklySummary(weekKey)
+	if err != nil {
+		log.Printf("Error saving weekly summary state: %v", err)
+	}
+	if !claimed {
+		return
+	}
+
+	report := ns.buildStatsReport(ns.subjectNames(), now.AddDate(0, 0, -7), now)
+	if report == "" {
+		log.Println("Weekly summary skipped: no finished sessions this week")
+		return
+	}
+
+	msg := ns.newMessage(ns.config.QueueChatID, ns.t("stats.weekly_header", nil)+"\n\n"+report)
+	if _, err := ns.bot.Send(msg); err != nil {
+		log.Printf("Error sending weekly summary: %v", err)
+		return
+	}
+	log.Printf("✅ Sent weekly summary for %s", weekKey)
+}
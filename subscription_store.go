@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+)
+
+const defaultWarnAhead = 2
+
+type Subscription struct {
+	UserID    int64  `json:"user_id"`
+	ChatID    int64  `json:"chat_id"`
+	Username  string `json:"username"`
+	RealName  string `json:"real_name"`
+	WarnAhead int    `json:"warn_ahead"`
+}
+
+type SubscriptionStore struct {
+	mu            sync.RWMutex
+	filename      string
+	subscriptions map[int64]Subscription
+}
+
+func NewSubscriptionStore(filename string) (*SubscriptionStore, error) {
+	ss := &SubscriptionStore{
+		filename:      filename,
+		subscriptions: make(map[int64]Subscription),
+	}
+
+	var subscriptions []Subscription
+	if err := loadJSONFile(filename, &subscriptions); err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("error loading subscriptions from %s: %w", filename, err)
+		}
+		log.Printf("Subscriptions file %s not found, starting with no subscribers", filename)
+	}
+
+	for _, subscription := range subscriptions {
+		ss.subscriptions[subscription.UserID] = subscription
+	}
+
+	log.Printf("Loaded %d reminder subscriptions", len(ss.subscriptions))
+	return ss, nil
+}
+
+func (ss *SubscriptionStore) save() error {
+	subscriptions := make([]Subscription, 0, len(ss.subscriptions))
+	for _, subscription := range ss.subscriptions {
+		subscriptions = append(subscriptions, subscription)
+	}
+
+	if err := saveJSONFile(ss.filename, subscriptions); err != nil {
+		return fmt.Errorf("error saving subscriptions to %s: %w", ss.filename, err)
+	}
+	return nil
+}
+
+func (ss *SubscriptionStore) Subscribe(subscription Subscription) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	subscription.WarnAhead = defaultWarnAhead
+	if existing, exists := ss.subscriptions[subscription.UserID]; exists {
+		subscription.WarnAhead = existing.WarnAhead
+	}
+
+	ss.subscriptions[subscription.UserID] = subscription
+	return ss.save()
+}
+
+func (ss *SubscriptionStore) Unsubscribe(userID int64) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	if _, exists := ss.subscriptions[userID]; !exists {
+		return nil
+	}
+
+	delete(ss.subscriptions, userID)
+	return ss.save()
+}
+
+func (ss *SubscriptionStore) SetWarnAhead(userID int64, warnAhead int) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	subscription, exists := ss.subscriptions[userID]
+	if !exists {
+		return fmt.Errorf("user %d is not subscribed", userID)
+	}
+
+	subscription.WarnAhead = warnAhead
+	ss.subscriptions[userID] = subscription
+	return ss.save()
+}
+
+func (ss *SubscriptionStore) Get(userID int64) (Subscription, bool) {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+
+	subscription, exists := ss.subscriptions[userID]
+	return subscription, exists
+}
+
+func (ss *SubscriptionStore) FindByRealName(realName string) (Subscription, bool) {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+
+	for _, subscription := range ss.subscriptions {
+		if subscription.RealName == realName {
+			return subscription, true
+		}
+	}
+	return Subscription{}, false
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+type SwapRequest struct {
+	ID        string
+	SessionID string
+	From      string
+	To        string
+	CreatedAt time.Time
+}
+
+func (qm *QueueManager) SwapEntries(sessionID, first, second string) error {
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+
+	session, exists := qm.sessions[sessionID]
+	if !exists {
+		return fmt.Errorf("session not found: %s", sessionID)
+	}
+
+	i, j := session.position(first), session.position(second)
+	if i < 0 || j < 0 {
+		return fmt.Errorf("both %s and %s must be in queue %s", first, second, sessionID)
+	}
+
+	if session.Queue[i].Status != EntryWaiting || session.Queue[j].Status != EntryWaiting {
+		return fmt.Errorf("only waiting students can swap places")
+	}
+
+	session.Queue[i], session.Queue[j] = session.Queue[j], session.Queue[i]
+	log.Printf("🔄 %s и %s поменялись местами в очереди %s", first, second, sessionID)
+	return nil
+}
+
+// findUserSession picks the session a command refers to. An optional
+// leading subject code selects it explicitly; otherwise the only active
+// session the student is signed up for is used. The remaining arguments
+// are returned as is.
+func (ns *NotificationService) findUserSession(args []string, realName string) (Session, []string, error) {
+	if len(args) > 0 {
+		if session, found := ns.resolveSession(args[0]); found {
+			return session, args[1:], nil
+		}
+	}
+
+	var candidates []Session
+	for _, session := range ns.queueManager.GetSessions() {
+		if session.State == SessionFinished || session.State == SessionScheduled {
+			continue
+		}
+		if session.position(realName) >= 0 || session.waitlistPosition(realName) >= 0 {
+			candidates = append(candidates, session)
+		}
+	}
+
+	switch len(candidates) {
+	case 0:
+		return Session{}, nil, errors.New(ns.t("swap.not_in_any_queue", nil))
+	case 1:
+		return candidates[0], args, nil
+	default:
+		return Session{}, nil, errors.New(ns.t("swap.ambiguous", nil))
+	}
+}
+
+func (ns *NotificationService) handleSwapCommand(message *tgbotapi.Message) {
+	user := message.From
+	realName := ns.queueManager.GetUserRealName(user.UserName, user.FirstName, user.LastName)
+	if realName == "" {
+		ns.reply(message, ns.t("common.unknown_user", nil))
+		return
+	}
+	ns.queueManager.RememberUserID(realName, user.ID)
+
+	session, args, err := ns.findUserSession(strings.Fields(message.CommandArguments()), realName)
+	if err != nil {
+		ns.reply(message, err.Error())
+		return
+	}
+	if len(args) != 1 {
+		ns.reply(message, ns.t("swap.usage", nil))
+		return
+	}
+	targetLastName := args[0]
+
+	if err := ns.syncQueueFromSheets(session); err != nil {
+		log.Printf("Warning: Could not sync with Google Sheets: %v", err)
+	}
+
+	targetName := ns.findFullNameByLastName(targetLastName)
+	fromPosition := ns.queueManager.GetUserPositionInQueue(session.ID, realName)
+	toPosition := ns.queueManager.GetUserPositionInQueue(session.ID, targetName)
+
+	switch {
+	case fromPosition <= 0:
+		ns.reply(message, ns.t("swap.not_in_queue", vars{"Subject": session.Subject.Name}))
+		return
+	case targetName == "" || toPosition <= 0:
+		ns.reply(message, ns.t("swap.target_not_in_queue", vars{"Name": targetLastName, "Subject": session.Subject.Name}))
+		return
+	case targetName == realName:
+		ns.reply(message, ns.t("swap.self", nil))
+		return
+	}
+
+	ns.swapMutex.Lock()
+	ns.swapCounter++
+	request := SwapRequest{
+		ID:        strconv.FormatInt(ns.swapCounter, 10),
+		SessionID: session.ID,
+		From:      realName,
+		To:        targetName,
+		CreatedAt: time.Now(),
+	}
+	ns.swapRequests[request.ID] = request
+	ns.swapMutex.Unlock()
+
+	text := ns.t("swap.request", vars{
+		"From":         realName,
+		"FromPosition": fromPosition,
+		"To":           targetName,
+		"ToPosition":   toPosition,
+		"Subject":      session.Subject.Name,
+		"Mention":      ns.mention(targetName),
+	})
+
+	acceptButton := tgbotapi.NewInlineKeyboardButtonData(ns.t("swap.button_accept", nil), fmt.Sprintf("swapok_%s", request.ID))
+	declineButton := tgbotapi.NewInlineKeyboardButtonData(ns.t("swap.button_decline", nil), fmt.Sprintf("swapno_%s", request.ID))
+
+	msg := ns.newMessage(message.Chat.ID, text)
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup([]tgbotapi.InlineKeyboardButton{acceptButton, declineButton})
+	if _, err := ns.bot.Send(msg); err != nil {
+		log.Printf("Error sending swap request: %v", err)
+	}
+
+	log.Printf("Swap request %s: %s ↔ %s in %s", request.ID, realName, targetName, session.ID)
+}
+
+func (ns *NotificationService) handleSwapResponse(callbackQuery *tgbotapi.CallbackQuery) {
+	action, requestID, _ := strings.Cut(callbackQuery.Data, "_")
+
+	user := callbackQuery.From
+	realName := ns.queueManager.GetUserRealName(user.UserName, user.FirstName, user.LastName)
+
+	request, err := ns.claimSwapRequest(requestID, realName)
+	if err != nil {
+		ns.answerCallback(callbackQuery.ID, err.Error())
+		return
+	}
+
+	chatID := callbackQuery.Message.Chat.ID
+	messageID := callbackQuery.Message.MessageID
+
+	if action == "swapno" {
+		ns.answerCallback(callbackQuery.ID, ns.t("swap.declined_answer", nil))
+		edit := ns.newEdit(chatID, messageID,
+			ns.t("swap.declined", vars{"From": request.From, "To": request.To}))
+		ns.bot.Send(edit)
+		return
+	}
+
+	session, exists := ns.queueManager.GetSession(request.SessionID)
+	if !exists {
+		ns.answerCallback(callbackQuery.ID, ns.t("swap.session_not_found", nil))
+		return
+	}
+
+	if err := ns.swapPlaces(session, request.From, request.To); err != nil {
+		log.Printf("Error swapping %s and %s in %s: %v", request.From, request.To, session.ID, err)
+		ns.answerCallback(callbackQuery.ID, ns.t("swap.failed", nil))
+		return
+	}
+
+	ns.answerCallback(callbackQuery.ID, ns.t("swap.accepted_answer", nil))
+
+	edit := ns.newEdit(chatID, messageID,
+		ns.t("swap.accepted", vars{
+			"From":         request.From,
+			"FromPosition": ns.queueManager.GetUserPositionInQueue(session.ID, request.From),
+			"To":           request.To,
+			"ToPosition":   ns.queueManager.GetUserPositionInQueue(session.ID, request.To),
+			"Subject":      session.Subject.Name,
+		}))
+	if _, err := ns.bot.Send(edit); err != nil {
+		log.Printf("Error updating swap message: %v", err)
+	}
+
+	ns.updateOrCreateQueueMessage(chatID, session)
+}
+
+// claimSwapRequest takes a request out of the pending ones for its addressee.
+// Telegram may deliver a double tap as two callbacks; only the first one
+// gets the request, the other is told it has expired.
+func (ns *NotificationService) claimSwapRequest(requestID, realName string) (SwapRequest, error) {
+	ns.swapMutex.Lock()
+	defer ns.swapMutex.Unlock()
+
+	request, exists := ns.swapRequests[requestID]
+	if !exists || time.Since(request.CreatedAt) > ns.config.SwapRequestTTL {
+		return SwapRequest{}, errors.New(ns.t("swap.expired", nil))
+	}
+	if realName != request.To {
+		return SwapRequest{}, errors.New(ns.t("swap.not_for_you", nil))
+	}
+
+	delete(ns.swapRequests, requestID)
+	return request, nil
+}
+
+// swapPlaces swaps two students in memory and in the sheet column,
+// rolling back the in-memory swap if the sheet update fails.
+func (ns *NotificationService) swapPlaces(session Session, first, second string) error {
+	defer ns.lockSheet(session.Subject.Name)()
+
+	if err := ns.syncQueueFromSheets(session); err != nil {
+		return err
+	}
+
+	if err := ns.queueManager.SwapEntries(session.ID, first, second); err != nil {
+		return err
+	}
+
+	if err := ns.sheetsService.SwapInSheet(session.Subject.Name, extractLastName(first), extractLastName(second)); err != nil {
+		if rollbackErr := ns.queueManager.SwapEntries(session.ID, first, second); rollbackErr != nil {
+			log.Printf("Error rolling back swap in %s: %v", session.ID, rollbackErr)
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (ns *NotificationService) cleanupExpiredSwapRequests() {
+	ns.swapMutex.Lock()
+	defer ns.swapMutex.Unlock()
+
+	for id, request := range ns.swapRequests {
+		if time.Since(request.CreatedAt) > ns.config.SwapRequestTTL {
+			delete(ns.swapRequests, id)
+		}
+	}
+}
@@ -1,13 +1,30 @@
 package main
 
+import "time"
+
 type Subject struct {
-	Day   string `json:"day"`
-	Start string `json:"start"`
-	Name  string `json:"name"`
-	End   string `json:"end"`
+	Day      string `json:"day"`
+	Start    string `json:"start"`
+	Name     string `json:"name"`
+	End      string `json:"end"`
+	Policy   string `json:"policy"`
+	Capacity int    `json:"capacity,omitempty"`
+
+	// Occurrences holds exact start times when the schedule comes from an
+	// iCalendar file; empty means the class repeats weekly on Day.
+	Occurrences []time.Time `json:"-"`
+
+	// Overrides holds cancelled and moved classes keyed by their regular
+	// date (YYYY-MM-DD).
+	Overrides map[string]ScheduleOverride `json:"-"`
 }
 
 type UserMapping struct {
 	TelegramUsername string `json:"TelegramUsername"`
 	RealName         string `json:"RealName"`
 }
+
+type StudentDebt struct {
+	RealName string `json:"RealName"`
+	Debts    int    `json:"Debts"`
+}
@@ -1,9 +1,15 @@
 package main
 
 import (
+	"encoding/json"
 	"log"
+	"os"
 	"strings"
+	"sync/atomic"
 	"time"
+	_ "time/tzdata"
+
+	"gopkg.in/yaml.v3"
 )
 
 func parseWeekday(day string) time.Weekday {
@@ -37,20 +43,58 @@ func numberToColumnLetter(num int) string {
 	return result
 }
 
-func getMoscowTime() time.Time {
-	moscowTZ, err := time.LoadLocation("Europe/Moscow")
+const defaultTimeZone = "Europe/Moscow"
+
+var location atomic.Pointer[time.Location]
+
+// setLocation sets the time zone used for the schedule and all formatted
+// times. It is called once at startup with the configured zone.
+func setLocation(loc *time.Location) {
+	location.Store(loc)
+}
+
+func getLocation() *time.Location {
+	if loc := location.Load(); loc != nil {
+		return loc
+	}
+	loc, err := time.LoadLocation(defaultTimeZone)
+	if err != nil {
+		log.Printf("Error loading %s timezone: %v, falling back to UTC", defaultTimeZone, err)
+		loc = time.UTC
+	}
+	location.CompareAndSwap(nil, loc)
+	return location.Load()
+}
+
+func getLocalTime() time.Time {
+	return time.Now().In(getLocation())
+}
+
+func loadJSONFile(filename string, v interface{}) error {
+	data, err := os.ReadFile(filename)
 	if err != nil {
-		log.Printf("Error loading Moscow timezone: %v, falling back to UTC", err)
-		moscowTZ = time.UTC
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func saveJSONFile(filename string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmpFile := filename + ".tmp"
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		return err
 	}
-	return time.Now().In(moscowTZ)
+	return os.Rename(tmpFile, filename)
 }
 
-func getMoscowLocation() *time.Location {
-	moscowTZ, err := time.LoadLocation("Europe/Moscow")
+func loadYAMLFile(filename string, v interface{}) error {
+	data, err := os.ReadFile(filename)
 	if err != nil {
-		log.Printf("Error loading Moscow timezone: %v, falling back to UTC", err)
-		return time.UTC
+		return err
 	}
-	return moscowTZ
+	return yaml.Unmarshal(data, v)
 }
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"html/template"
+	"log"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// JoinOrWaitlist signs a student up in one step: into the queue while it has
+// room, otherwise onto the waitlist. It reports the position, whether it is
+// on the waitlist and whether the student was added just now.
+func (qm *QueueManager) JoinOrWaitlist(sessionID, realName string) (int, bool, bool) {
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+
+	session, exists := qm.sessions[sessionID]
+	if !exists {
+		return 0, false, false
+	}
+
+	if i := session.position(realName); i >= 0 {
+		return i + 1, false, false
+	}
+	if i := session.waitlistPosition(realName); i >= 0 {
+		return i + 1, true, false
+	}
+
+	entry := QueueEntry{Name: realName, JoinedAt: time.Now()}
+	if session.IsFull() {
+		session.Waitlist = append(session.Waitlist, entry)
+		log.Printf("📝 Пользователь %s добавлен в лист ожидания %s на позицию %d", realName, sessionID, len(session.Waitlist))
+		return len(session.Waitlist), true, true
+	}
+
+	session.Queue = append(session.Queue, entry)
+	log.Printf("✅ Пользователь %s добавлен в очередь %s на позицию %d", realName, sessionID, len(session.Queue))
+	return len(session.Queue), false, true
+}
+
+// CancelJoin takes back a sign-up that could not be written to the sheet,
+// leaving no trace in the departed list.
+func (qm *QueueManager) CancelJoin(sessionID, realName string) {
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+
+	session, exists := qm.sessions[sessionID]
+	if !exists {
+		return
+	}
+	if i := session.position(realName); i >= 0 {
+		session.Queue = append(session.Queue[:i], session.Queue[i+1:]...)
+	}
+}
+
+func (qm *QueueManager) RemoveFromWaitlist(sessionID, realName string) bool {
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+
+	session, exists := qm.sessions[sessionID]
+	if !exists {
+		return false
+	}
+
+	i := session.waitlistPosition(realName)
+	if i < 0 {
+		return false
+	}
+
+	entry := session.Waitlist[i]
+	entry.LeftAt = time.Now()
+	session.Departed = append(session.Departed, entry)
+	session.Waitlist = append(session.Waitlist[:i], session.Waitlist[i+1:]...)
+	return true
+}
+
+func (qm *QueueManager) GetWaitlist(sessionID string) []string {
+	qm.mu.RLock()
+	defer qm.mu.RUnlock()
+
+	session, exists := qm.sessions[sessionID]
+	if !exists {
+		return []string{}
+	}
+	return session.WaitlistNames()
+}
+
+func (qm *QueueManager) GetWaitlistPosition(sessionID, realName string) int {
+	qm.mu.RLock()
+	defer qm.mu.RUnlock()
+
+	session, exists := qm.sessions[sessionID]
+	if !exists {
+		return -1
+	}
+
+	if i := session.waitlistPosition(realName); i >= 0 {
+		return i + 1
+	}
+	return -1
+}
+
+func (qm *QueueManager) SyncWaitlist(sessionID string, names []string) {
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+
+	session, exists := qm.sessions[sessionID]
+	if !exists {
+		return
+	}
+
+	existing := make(map[string]QueueEntry, len(session.Waitlist))
+	for _, entry := range session.Waitlist {
+		existing[entry.Name] = entry
+	}
+
+	now := time.Now()
+	waitlist := make([]QueueEntry, 0, len(names))
+	for _, name := range names {
+		if session.position(name) >= 0 {
+			continue
+		}
+		entry, exists := existing[name]
+		if !exists {
+			entry = QueueEntry{Name: name, JoinedAt: now}
+		}
+		waitlist = append(waitlist, entry)
+	}
+	session.Waitlist = waitlist
+}
+
+// PromoteFromWaitlist moves the first waitlisted student into the queue if
+// there is a free place.
+func (qm *QueueManager) PromoteFromWaitlist(sessionID string) (QueueEntry, bool) {
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+
+	session, exists := qm.sessions[sessionID]
+	if !exists || len(session.Waitlist) == 0 || session.IsFull() {
+		return QueueEntry{}, false
+	}
+
+	entry := session.Waitlist[0]
+	session.Waitlist = session.Waitlist[1:]
+	session.Queue = append(session.Queue, entry)
+	log.Printf("⬆️  Пользователь %s переведён из листа ожидания в очередь %s", entry.Name, sessionID)
+	return entry, true
+}
+
+// EnforceCapacity moves everyone beyond the capacity to the front of the
+// waitlist, keeping their relative order.
+func (qm *QueueManager) EnforceCapacity(sessionID string) []string {
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+
+	session, exists := qm.sessions[sessionID]
+	if !exists || session.Subject.Capacity <= 0 || len(session.Queue) <= session.Subject.Capacity {
+		return nil
+	}
+	if session.Subject.Policy == PolicyLottery && session.LotteryDrawnAt.IsZero() {
+		return nil
+	}
+
+	overflow := make([]QueueEntry, len(session.Queue)-session.Subject.Capacity)
+	copy(overflow, session.Queue[session.Subject.Capacity:])
+	session.Queue = session.Queue[:session.Subject.Capacity]
+
+	// After a hand edit of the sheet someone may be both in the queue and on
+	// the waitlist; keep a single entry for them.
+	waitlist := overflow
+	for _, entry := range session.Waitlist {
+		if session.position(entry.Name) < 0 && !containsEntry(overflow, entry.Name) {
+			waitlist = append(waitlist, entry)
+		}
+	}
+	session.Waitlist = waitlist
+
+	moved := make([]string, len(overflow))
+	for i, entry := range overflow {
+		moved[i] = entry.Name
+	}
+	return moved
+}
+
+func containsEntry(entries []QueueEntry, name string) bool {
+	for _, entry := range entries {
+		if entry.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (ns *NotificationService) writeWaitlistToSheets(session Session) {
+	waitlist := ns.queueManager.GetWaitlist(session.ID)
+	lastNames := make([]string, len(waitlist))
+	for i, name := range waitlist {
+		lastNames[i] = extractLastName(name)
+	}
+
+	if err := ns.sheetsService.WriteWaitlist(session.Subject.Name, lastNames); err != nil {
+		log.Printf("Error writing waitlist %s to Google Sheets: %v", session.ID, err)
+	}
+}
+
+func (ns *NotificationService) syncWaitlistFromSheets(session Session) error {
+	lastNames, err := ns.sheetsService.GetWaitlistFromSheet(session.Subject.Name)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(lastNames))
+	for _, lastName := range lastNames {
+		if fullName := ns.findFullNameByLastName(lastName); fullName != "" {
+			names = append(names, fullName)
+		} else {
+			names = append(names, lastName)
+		}
+	}
+
+	ns.queueManager.SyncWaitlist(session.ID, names)
+	return nil
+}
+
+func (ns *NotificationService) waitlistJoined(chatID int64, session Session, realName string, position int, answer func(string)) {
+	answer(ns.t("waitlist.joined", vars{"Capacity": session.Subject.Capacity, "Position": position}))
+
+	ns.announce(chatID, ns.t("waitlist.announce", vars{"Name": extractLastName(realName), "Subject": session.Subject.Name, "Position": position}))
+
+	ns.updateOrCreateQueueMessage(chatID, session)
+
+	log.Printf("User %s joined waitlist for %s (position %d)", realName, session.Subject.Name, position)
+}
+
+func (ns *NotificationService) waitlistLeft(callbackQuery *tgbotapi.CallbackQuery, session Session, realName string) {
+	ns.answerCallback(callbackQuery.ID, ns.t("waitlist.left", nil))
+
+	ns.updateOrCreateQueueMessage(callbackQuery.Message.Chat.ID, session)
+
+	log.Printf("User %s left waitlist for %s", realName, session.Subject.Name)
+}
+
+// promoteFromWaitlist fills free places from the waitlist, in memory and in
+// the sheet, and returns who was moved up. The caller holds the sheet lock.
+func (ns *NotificationService) promoteFromWaitlist(session Session) []QueueEntry {
+	var promoted []QueueEntry
+	for {
+		entry, ok := ns.queueManager.PromoteFromWaitlist(session.ID)
+		if !ok {
+			return promoted
+		}
+
+		lastName := extractLastName(entry.Name)
+		if err := ns.sheetsService.AddToSheet(session.Subject.Name, lastName); err != nil {
+			log.Printf("Error adding promoted user %s to Google Sheets: %v", entry.Name, err)
+		} else if entry.Note != "" {
+			if err := ns.sheetsService.WriteNote(session.Subject.Name, lastName, entry.Note); err != nil {
+				log.Printf("Error writing note for promoted user %s: %v", entry.Name, err)
+			}
+		}
+		ns.writeWaitlistToSheets(session)
+		promoted = append(promoted, entry)
+	}
+}
+
+func (ns *NotificationService) notifyPromoted(session Session, promoted []QueueEntry) {
+	for _, entry := range promoted {
+		position := ns.queueManager.GetUserPositionInQueue(session.ID, entry.Name)
+		text := ns.t("waitlist.promoted", vars{"Subject": session.Subject.Name, "Position": position})
+
+		if subscription, subscribed := ns.subscriptionStore.FindByRealName(entry.Name); subscribed {
+			ns.sendDirectMessage(subscription, text)
+		} else {
+			msg := ns.newMessage(ns.config.QueueChatID, ns.t("waitlist.promoted_mention", vars{"Mention": ns.mention(entry.Name), "Text": template.HTML(text)}))
+			if _, err := ns.bot.Send(msg); err != nil {
+				log.Printf("Error sending promotion message: %v", err)
+			}
+		}
+	}
+}
+
+func (ns *NotificationService) enforceCapacity(session Session) {
+	moved := ns.queueManager.EnforceCapacity(session.ID)
+	if len(moved) == 0 {
+		return
+	}
+
+	ns.writeQueueToSheets(session)
+	ns.writeWaitlistToSheets(session)
+
+	log.Printf("📝 %d человек перенесены в лист ожидания %s: %v", len(moved), session.ID, moved)
+}